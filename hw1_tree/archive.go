@@ -0,0 +1,401 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// a nil fs.FS if path is not an archive we can list
+func openArchive(path string) (fs.FS, io.Closer, error) {
+	lower := strings.ToLower(path)
+	switch {
+	case strings.HasSuffix(lower, ".zip"):
+		r, err := zip.OpenReader(path)
+		if err != nil {
+			return nil, nil, err
+		}
+		fsys, err := loadZip(&r.Reader)
+		if err != nil {
+			r.Close()
+			return nil, nil, err
+		}
+		return fsys, r, nil
+	case strings.HasSuffix(lower, ".tar"):
+		fsys, err := loadTarFile(path, false)
+		return fsys, nil, err
+	case strings.HasSuffix(lower, ".tar.gz"), strings.HasSuffix(lower, ".tgz"):
+		fsys, err := loadTarFile(path, true)
+		return fsys, nil, err
+	}
+	return nil, nil, nil
+}
+
+func loadTarFile(path string, gzipped bool) (fs.FS, error) {
+	return loadTar(func() (io.ReadCloser, error) {
+		return openTar(path, gzipped)
+	})
+}
+
+// the tar stream in the file at path
+func openTar(path string, gzipped bool) (io.ReadCloser, error) {
+	f, err := os.Open(path)
+	if err != nil || !gzipped {
+		return f, err
+	}
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{gz, f}, nil
+}
+
+// tar streams have no index: the listing is read up front, from the headers
+// only; a file opened (--dups, --grep, --hashes) is read in a pass of its own,
+// up to its header, and nothing of it is kept
+func loadTar(open func() (io.ReadCloser, error)) (*archiveFS, error) {
+	t := newArchiveFS()
+	t.open = open
+	err := eachTarHeader(open, func(idx int, name string, hdr *tar.Header) error {
+		entry := t.parent(name).child(t, name)
+		entry.sys = hdr
+		entry.mode = hdr.FileInfo().Mode()
+		entry.modTime = hdr.ModTime
+		entry.size, entry.index = 0, -1
+		switch hdr.Typeflag {
+		case tar.TypeSymlink:
+			entry.target = hdr.Linkname
+		case tar.TypeLink:
+			// hard link: same content as an earlier entry
+			if orig, ok := t.entries[path.Clean(hdr.Linkname)]; ok {
+				entry.index, entry.size = orig.index, orig.size
+				entry.mode = orig.mode
+			}
+		case tar.TypeReg:
+			entry.index, entry.size = idx, hdr.Size
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	t.sortChildren()
+	return t, nil
+}
+
+// call f for every header of the tar stream with a name inside it; idx counts
+// all of them
+func eachTarHeader(open func() (io.ReadCloser, error), f func(idx int, name string, hdr *tar.Header) error) error {
+	rc, err := open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	tr := tar.NewReader(rc)
+	for idx := 0; ; idx++ {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		name := path.Clean(strings.TrimPrefix(hdr.Name, "./"))
+		if name == "." || !fs.ValidPath(name) {
+			continue // absolute or escaping names: nothing to show
+		}
+		if err := f(idx, name, hdr); err != nil {
+			return err
+		}
+	}
+}
+
+// the content of the idx-th header of the tar stream, from a new pass over it;
+// the bodies before it are skipped (seeked over in a plain .tar)
+func openTarEntry(open func() (io.ReadCloser, error), idx int) (io.ReadCloser, error) {
+	rc, err := open()
+	if err != nil {
+		return nil, err
+	}
+	tr := tar.NewReader(rc)
+	for i := 0; i <= idx; i++ {
+		if _, err := tr.Next(); err != nil {
+			rc.Close()
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF // the archive changed since it was listed
+			}
+			return nil, err
+		}
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{tr, rc}, nil
+}
+
+// a zip archive has an index: list it, read the contents when they are opened
+func loadZip(r *zip.Reader) (*archiveFS, error) {
+	t := newArchiveFS()
+	for _, f := range r.File {
+		name := path.Clean(strings.TrimPrefix(f.Name, "./"))
+		if name == "." || !fs.ValidPath(name) {
+			continue // absolute or escaping names: nothing to show
+		}
+
+		entry := t.parent(name).child(t, name)
+		entry.sys = &f.FileHeader
+		entry.mode = f.Mode()
+		entry.modTime = f.Modified
+		switch {
+		case entry.mode&fs.ModeSymlink != 0:
+			// zip -y stores the target as the content
+			target, err := readZipLink(f)
+			if err != nil {
+				return nil, err
+			}
+			entry.target = target
+		case entry.mode.IsRegular():
+			entry.file = f
+			entry.size = int64(f.UncompressedSize64)
+		}
+	}
+	t.sortChildren()
+	return t, nil
+}
+
+func readZipLink(f *zip.File) (string, error) {
+	rc, err := f.Open()
+	if err != nil {
+		return "", err
+	}
+	defer rc.Close()
+	target, err := io.ReadAll(io.LimitReader(rc, 4096))
+	return string(target), err
+}
+
+// read-only fs.FS over the contents of a tar or zip archive, symlinks included
+type archiveFS struct {
+	entries map[string]*archiveEntry      // by clean name, "." is the root
+	open    func() (io.ReadCloser, error) // tar: the stream, from the start
+}
+
+type archiveEntry struct {
+	name     string
+	sys      any // *tar.Header or *zip.FileHeader; nil for directories the archive only implies
+	mode     fs.FileMode
+	modTime  time.Time
+	size     int64
+	index    int       // tar: the header holding the content, -1 for none
+	file     *zip.File // zip: read when opened
+	target   string    // symlinks
+	children []string  // base names, directories only
+}
+
+// nested links are followed this many times
+const maxArchiveLinks = 40
+
+func newArchiveFS() *archiveFS {
+	return &archiveFS{entries: map[string]*archiveEntry{
+		".": {name: ".", mode: fs.ModeDir | 0755},
+	}}
+}
+
+func (t *archiveFS) sortChildren() {
+	for _, entry := range t.entries {
+		sort.Strings(entry.children)
+	}
+}
+
+// the directory entry of name, created on the fly if the archive skipped it
+func (t *archiveFS) parent(name string) *archiveEntry {
+	dir := path.Dir(name)
+	if entry, ok := t.entries[dir]; ok {
+		return entry
+	}
+	entry := t.parent(dir).child(t, dir)
+	entry.mode = fs.ModeDir | 0755
+	return entry
+}
+
+func (dir *archiveEntry) child(t *archiveFS, name string) *archiveEntry {
+	if entry, ok := t.entries[name]; ok {
+		return entry // e.g. a directory implied by an earlier entry
+	}
+	entry := &archiveEntry{name: name}
+	t.entries[name] = entry
+	dir.children = append(dir.children, path.Base(name))
+	return entry
+}
+
+var errTooManyLinks = errors.New("too many levels of symbolic links")
+
+// find name, following links on the way (and at the end if follow)
+func (t *archiveFS) lookup(op, name string, follow bool) (*archiveEntry, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	var parts []string
+	if name != "." {
+		parts = strings.Split(name, "/")
+	}
+	cur, hops := ".", 0
+	for i := 0; i < len(parts); i++ {
+		if !t.entries[cur].mode.IsDir() {
+			return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+		}
+		next := path.Join(cur, parts[i])
+		entry, ok := t.entries[next]
+		if !ok {
+			return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+		}
+		if entry.mode&fs.ModeSymlink != 0 && (follow || i < len(parts)-1) {
+			if hops++; hops > maxArchiveLinks {
+				return nil, &fs.PathError{Op: op, Path: name, Err: errTooManyLinks}
+			}
+			resolved := path.Join(cur, entry.target)
+			if path.IsAbs(entry.target) || !fs.ValidPath(resolved) {
+				// points out of the archive
+				return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+			}
+			// start over with the link replaced by its target
+			rest := parts[i+1:]
+			parts = nil
+			if resolved != "." {
+				parts = strings.Split(resolved, "/")
+			}
+			parts = append(parts, rest...)
+			cur, i = ".", -1
+			continue
+		}
+		cur = next
+	}
+	return t.entries[cur], nil
+}
+
+func (t *archiveFS) Open(name string) (fs.File, error) {
+	entry, err := t.lookup("open", name, true)
+	if err != nil {
+		return nil, err
+	}
+	f := &archiveFile{fsys: t, entry: entry, info: archiveInfo{entry, path.Base(name)}, r: bytes.NewReader(nil)}
+	switch {
+	case entry.file != nil:
+		rc, err := entry.file.Open()
+		if err != nil {
+			return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+		}
+		f.r, f.closer = rc, rc
+	case t.open != nil && entry.index >= 0 && entry.mode.IsRegular():
+		rc, err := openTarEntry(t.open, entry.index)
+		if err != nil {
+			return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+		}
+		f.r, f.closer = rc, rc
+	}
+	return f, nil
+}
+
+func (t *archiveFS) Stat(name string) (fs.FileInfo, error) {
+	entry, err := t.lookup("stat", name, true)
+	if err != nil {
+		return nil, err
+	}
+	return archiveInfo{entry, path.Base(name)}, nil
+}
+
+func (t *archiveFS) Lstat(name string) (fs.FileInfo, error) {
+	entry, err := t.lookup("lstat", name, false)
+	if err != nil {
+		return nil, err
+	}
+	return archiveInfo{entry, path.Base(name)}, nil
+}
+
+func (t *archiveFS) ReadLink(name string) (string, error) {
+	entry, err := t.lookup("readlink", name, false)
+	if err != nil {
+		return "", err
+	}
+	if entry.mode&fs.ModeSymlink == 0 {
+		return "", &fs.PathError{Op: "readlink", Path: name, Err: fs.ErrInvalid}
+	}
+	return entry.target, nil
+}
+
+func (t *archiveFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	entry, err := t.lookup("readdir", name, true)
+	if err != nil {
+		return nil, err
+	}
+	if !entry.mode.IsDir() {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: errors.New("not a directory")}
+	}
+	list := make([]fs.DirEntry, 0, len(entry.children))
+	for _, child := range entry.children {
+		info := archiveInfo{t.entries[path.Join(entry.name, child)], child}
+		list = append(list, fs.FileInfoToDirEntry(info))
+	}
+	return list, nil
+}
+
+// fs.FileInfo under the name it was asked for (links keep their own name)
+type archiveInfo struct {
+	entry *archiveEntry
+	name  string
+}
+
+func (info archiveInfo) Name() string       { return info.name }
+func (info archiveInfo) Size() int64        { return info.entry.size }
+func (info archiveInfo) Mode() fs.FileMode  { return info.entry.mode }
+func (info archiveInfo) ModTime() time.Time { return info.entry.modTime }
+func (info archiveInfo) IsDir() bool        { return info.entry.mode.IsDir() }
+func (info archiveInfo) Sys() any           { return info.entry.sys }
+
+type archiveFile struct {
+	fsys   *archiveFS
+	entry  *archiveEntry
+	info   archiveInfo
+	r      io.Reader
+	closer io.Closer // zip contents
+	offset int       // ReadDir position
+}
+
+func (f *archiveFile) Stat() (fs.FileInfo, error) { return f.info, nil }
+func (f *archiveFile) Read(p []byte) (int, error) { return f.r.Read(p) }
+func (f *archiveFile) Close() error {
+	if f.closer == nil {
+		return nil
+	}
+	return f.closer.Close()
+}
+
+func (f *archiveFile) ReadDir(n int) ([]fs.DirEntry, error) {
+	list, err := f.fsys.ReadDir(f.entry.name)
+	if err != nil {
+		return nil, err
+	}
+	list = list[f.offset:]
+	if n > 0 {
+		if len(list) == 0 {
+			return nil, io.EOF
+		}
+		if n < len(list) {
+			list = list[:n]
+		}
+	}
+	f.offset += len(list)
+	return list, nil
+}
@@ -0,0 +1,428 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// exit codes; treediff follows diff(1): 0 same, 1 different, 2 trouble
+const (
+	exitOK     = 0
+	exitFailed = 1 // some paths or entries could not be read, the output may be partial
+	exitUsage  = 2
+)
+
+const usageText = `usage: tree [flags] [path ...]
+       tree treediff [flags] old new
+       tree serve [flags] [--addr host:port] [path]
+
+List the directories (with -f also the files) below each path. A path may be
+a directory, a .zip/.tar/.tar.gz archive, a snapshot saved with
+--format snapshot or a single file; the default is ".".
+treediff compares two of them, or trees saved with -J. serve shares the
+listing over HTTP, loading directories as they are opened; links leading out
+of the path are not followed unless --links says otherwise.
+
+Flags may come before or after the paths, single-letter flags may be grouped
+(-fh, -fL2). Exit status: 0 ok, 1 partial output, 2 bad usage; treediff exits
+0 without differences, 1 with differences and 2 on errors.
+
+flags:
+`
+
+// the command line minus the program name; returns the exit code
+func run(args []string, stdout, stderr io.Writer) int {
+	if len(args) > 0 && args[0] == "treediff" {
+		return runDiff(args[1:], stdout, stderr)
+	}
+	if len(args) > 0 && args[0] == "serve" {
+		return runServe(args[1:], stdout, stderr)
+	}
+
+	opts := options{format: formatText, links: linksFollow}
+	flags := newFlagSet("tree", &opts)
+	paths, err := parseFlags(flags, args)
+	if err == nil && opts.watch && len(paths) > 1 {
+		err = errors.New("watch mode takes a single path")
+	}
+	if err == nil {
+		err = checkStream(opts)
+	}
+	if err == nil {
+		err = checkGrep(opts)
+	}
+	if err == nil && opts.format == formatSnapshot {
+		switch {
+		case len(paths) > 1:
+			err = errors.New("a snapshot holds a single tree")
+		case isTerminal(stdout):
+			err = errors.New("not writing a binary snapshot to a terminal, redirect it to a file")
+		}
+	}
+	if code, done := usageStatus(flags, err, stdout, stderr); done {
+		return code
+	}
+	if len(paths) == 0 {
+		paths = []string{"."}
+	}
+	opts.colors = colorsFor(opts.color, stdout)
+
+	if opts.watch {
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer stop()
+		err = watchTree(ctx, stdout, paths[0], opts)
+	} else {
+		err = renderTrees(stdout, paths, opts)
+	}
+	if err != nil {
+		report(stderr, "tree", err)
+		return exitFailed
+	}
+	return exitOK
+}
+
+func runDiff(args []string, stdout, stderr io.Writer) int {
+	opts := options{format: formatText, links: linksFollow}
+	flags := newFlagSet("treediff", &opts)
+	paths, err := parseFlags(flags, args)
+	if err == nil && len(paths) != 2 {
+		err = errors.New("treediff needs an old and a new path")
+	}
+	if err == nil && opts.stream {
+		err = errors.New("treediff needs both trees in memory, --stream does not apply")
+	}
+	if code, done := usageStatus(flags, err, stdout, stderr); done {
+		return code
+	}
+
+	opts.colors = colorsFor(opts.color, stdout)
+	changed, err := treeDiff(stdout, paths[0], paths[1], opts)
+	if err != nil {
+		report(stderr, "treediff", err)
+		return exitUsage
+	}
+	if changed {
+		return exitFailed
+	}
+	return exitOK
+}
+
+func runServe(args []string, stdout, stderr io.Writer) int {
+	// links leading out of the shared directory stay closed unless asked for
+	opts := options{format: formatText, links: linksInside}
+	flags := newFlagSet("serve", &opts)
+	addr := flags.String("addr", "localhost:8080", "listen on `host:port`")
+	paths, err := parseFlags(flags, args)
+	if err == nil && len(paths) > 1 {
+		err = errors.New("serve takes a single path")
+	}
+	if code, done := usageStatus(flags, err, stdout, stderr); done {
+		return code
+	}
+	if len(paths) == 0 {
+		paths = []string{"."}
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	if err := serveTree(ctx, stderr, *addr, paths[0], opts); err != nil {
+		report(stderr, "serve", err)
+		return exitFailed
+	}
+	return exitOK
+}
+
+// --help and bad arguments end the run before anything is listed
+func usageStatus(flags *flag.FlagSet, err error, stdout, stderr io.Writer) (int, bool) {
+	switch {
+	case err == nil:
+		return 0, false
+	case errors.Is(err, flag.ErrHelp):
+		fmt.Fprint(stdout, usageText)
+		flags.SetOutput(stdout)
+		flags.PrintDefaults()
+		flags.SetOutput(io.Discard)
+		return exitOK, true
+	}
+	fmt.Fprintf(stderr, "%s: %v\nrun with --help for usage\n", flags.Name(), err)
+	return exitUsage, true
+}
+
+// the tree is already out, only the failures go to stderr
+func report(stderr io.Writer, name string, err error) {
+	if errs, ok := err.(walkErrors); ok {
+		errs.summary(stderr)
+		return
+	}
+	fmt.Fprintf(stderr, "%s: %v\n", name, err)
+}
+
+// every flag sets a field of opts
+func newFlagSet(name string, opts *options) *flag.FlagSet {
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	flags.SetOutput(io.Discard) // errors and usage are printed by run
+	flags.Usage = func() {}
+
+	// what is listed
+	flags.BoolVar(&opts.printFiles, "f", false, "list files, not only directories")
+	flags.Func("L", "descend at most `level` directories", func(s string) error {
+		level, err := strconv.Atoi(s)
+		if err != nil || level < 1 {
+			return errors.New("not a positive number")
+		}
+		opts.maxDepth = level
+		return nil
+	})
+	flags.Func("I", "skip files and directories matching `pattern` (repeatable)", globList(&opts.exclude))
+	flags.Func("P", "only list files matching `pattern` (repeatable)", globList(&opts.include))
+	flags.Func("grep", "only list files whose content matches `regexp`, and the directories leading to them", func(s string) error {
+		re, err := regexp.Compile(s)
+		if err != nil {
+			return err
+		}
+		opts.grep = re
+		return nil
+	})
+	flags.Func("grep-max-size", "do not search files larger than `size` (default 10M)", func(s string) error {
+		size, err := parseSize(s)
+		opts.grepMaxSize = size
+		return err
+	})
+	flags.BoolVar(&opts.gitignore, "gitignore", false, "honor .gitignore files")
+	flags.Func("links", "symlinks: follow, show or inside (follow only within the root)", func(s string) error {
+		switch s {
+		case linksFollow, linksShow, linksInside:
+			opts.links = s
+			return nil
+		}
+		return errors.New("not follow, show or inside")
+	})
+	flags.BoolVar(&opts.keepGoing, "k", false, "mark unreadable entries instead of failing")
+	flags.BoolVar(&opts.keepGoing, "keep-going", false, "same as -k")
+	flags.Func("j", "list `n` directories concurrently", func(s string) error {
+		workers, err := strconv.Atoi(s)
+		if err != nil || workers < 1 {
+			return errors.New("not a positive number")
+		}
+		opts.workers = workers
+		return nil
+	})
+
+	// how it is shown
+	flags.Func("format", "output `format`: text, json, xml, html or snapshot (binary, can be listed like a directory)", func(s string) error {
+		switch s {
+		case formatText, formatJSON, formatXML, formatHTML, formatSnapshot:
+			opts.format = s
+			return nil
+		}
+		return errors.New("not text, json, xml, html or snapshot")
+	})
+	flags.BoolFunc("J", "JSON output", func(string) error {
+		opts.format = formatJSON
+		return nil
+	})
+	flags.BoolFunc("X", "XML output", func(string) error {
+		opts.format = formatXML
+		return nil
+	})
+	flags.Func("color", "color names by LS_COLORS: `when` always, never or auto (on a terminal)", func(s string) error {
+		switch s {
+		case colorAuto, colorAlways, colorNever:
+			opts.color = s
+			return nil
+		}
+		return errors.New("not always, never or auto")
+	})
+	flags.BoolVar(&opts.hashes, "hashes", false, "store sha256 hashes of the files in snapshots, compare them in treediff")
+	flags.BoolVar(&opts.du, "du", false, "show recursive size and file count of directories")
+	flags.BoolVar(&opts.human, "h", false, "human-readable sizes (KiB, MiB, ...)")
+	flags.BoolVar(&opts.dups, "dups", false, "report files with identical content")
+	flags.BoolFunc("dups-mark", "like --dups, and mark the duplicates in the tree", func(string) error {
+		opts.dups, opts.markDups = true, true
+		return nil
+	})
+	flags.BoolVar(&opts.stats, "stats", false, "print counts, extensions, the largest files and the deepest path after the tree")
+	flags.Func("top", "list `n` rows in the --stats tables (default 5)", func(s string) error {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 {
+			return errors.New("not a positive number")
+		}
+		opts.stats, opts.statsTop = true, n
+		return nil
+	})
+	flags.BoolVar(&opts.stream, "stream", false, "print while walking instead of holding the whole tree in memory")
+	flags.BoolVar(&opts.watch, "watch", false, "keep running and re-print the tree on changes")
+
+	// order
+	flags.Func("sort", "sort by `key`: name, size, mtime, ext or version", func(s string) error {
+		switch s {
+		case sortByName, sortBySize, sortByTime, sortByExt, sortByVersion:
+			opts.sortBy = s
+			return nil
+		}
+		return errors.New("not name, size, mtime, ext or version")
+	})
+	flags.BoolFunc("t", "sort by modification time", func(string) error {
+		opts.sortBy = sortByTime
+		return nil
+	})
+	flags.BoolFunc("v", "sort by version", func(string) error {
+		opts.sortBy = sortByVersion
+		return nil
+	})
+	flags.BoolVar(&opts.reverse, "r", false, "reverse the sort order")
+	flags.BoolVar(&opts.dirsFirst, "dirsfirst", false, "list directories before files")
+
+	// columns
+	flags.BoolVar(&opts.columns.perms, "p", false, "show permissions")
+	flags.BoolVar(&opts.columns.user, "u", false, "show the owner")
+	flags.BoolVar(&opts.columns.group, "g", false, "show the group")
+	flags.BoolVar(&opts.columns.date, "D", false, "show the modification date")
+	flags.BoolVar(&opts.columns.inode, "inodes", false, "show inode numbers")
+	flags.Func("timefmt", "date `layout` (Go time format), implies -D", func(s string) error {
+		opts.columns.date, opts.columns.timeFormat = true, s
+		return nil
+	})
+	return flags
+}
+
+// a repeatable glob flag
+func globList(patterns *[]string) func(string) error {
+	return func(s string) error {
+		if err := checkGlob(s); err != nil {
+			return err
+		}
+		*patterns = append(*patterns, s)
+		return nil
+	}
+}
+
+// flag.Parse stops at the first path; keep parsing so that flags may follow
+// the paths ("main . -f"). Everything after "--" is a path.
+func parseFlags(flags *flag.FlagSet, args []string) ([]string, error) {
+	args = splitGroups(flags, args)
+	var paths []string
+	for {
+		if err := flags.Parse(args); err != nil {
+			return nil, err
+		}
+		rest := flags.Args()
+		if n := len(args) - len(rest); n > 0 && args[n-1] == "--" {
+			return append(paths, rest...), nil
+		}
+		if len(rest) == 0 {
+			return paths, nil
+		}
+		paths, args = append(paths, rest[0]), rest[1:]
+	}
+}
+
+// "-fhL2" -> "-f" "-h" "-L" "2", the way getopt reads grouped switches
+func splitGroups(flags *flag.FlagSet, args []string) []string {
+	var out []string
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" {
+			return append(out, args[i:]...)
+		}
+		if len(arg) < 2 || arg[0] != '-' {
+			out = append(out, arg) // a path
+			continue
+		}
+		name, _, hasValue := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+
+		group, takesNext := []string{arg}, false
+		if f := flags.Lookup(name); f != nil {
+			takesNext = !hasValue && !isBoolFlag(f)
+		} else if arg[1] != '-' {
+			if split, next, ok := splitGroup(flags, arg[1:]); ok {
+				group, takesNext = split, next
+			}
+		}
+		out = append(out, group...)
+		if takesNext && i+1 < len(args) {
+			i++
+			out = append(out, args[i]) // the value, even if it starts with "-"
+		}
+	}
+	return out
+}
+
+// the letters of a group; the first one that takes a value ends it, the rest
+// of the group is that value, or the next argument if there is no rest
+func splitGroup(flags *flag.FlagSet, group string) ([]string, bool, bool) {
+	var out []string
+	for i, c := range group {
+		f := flags.Lookup(string(c))
+		if f == nil {
+			return nil, false, false
+		}
+		out = append(out, "-"+string(c))
+		if !isBoolFlag(f) {
+			if value := group[i+1:]; value != "" {
+				return append(out, value), false, true
+			}
+			return out, true, true
+		}
+	}
+	return out, false, true
+}
+
+func isBoolFlag(f *flag.Flag) bool {
+	b, ok := f.Value.(interface{ IsBoolFlag() bool })
+	return ok && b.IsBoolFlag()
+}
+
+// one tree per path; several text trees get an ls-style "path:" header, the
+// structured formats put them into one document
+func renderTrees(out io.Writer, paths []string, opts options) error {
+	if len(paths) == 1 {
+		return dirTreeWith(out, paths[0], opts)
+	}
+	var errs walkErrors
+	var trees []*dirFile
+	listed := 0
+	for _, path := range paths {
+		src, err := openSource(path)
+		if err != nil {
+			errs = append(errs, walkError{path: path, err: err}) // like ls: list the rest
+			continue
+		}
+		if opts.format == formatText {
+			if listed > 0 {
+				fmt.Fprintln(out)
+			}
+			fmt.Fprintf(out, "%s:\n", path)
+			err = renderTree(out, src, opts)
+			listed++
+		} else {
+			var tree *dirFile
+			if tree, _, err = loadRoot(src, opts); tree != nil {
+				trees = append(trees, tree)
+			}
+		}
+		src.Close()
+		if more, ok := err.(walkErrors); ok {
+			errs = append(errs, more...)
+		} else if err != nil {
+			return err
+		}
+	}
+	if opts.format != formatText && len(trees) > 0 {
+		if err := writeTrees(out, trees, opts); err != nil {
+			return err
+		}
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseFlags(t *testing.T) {
+	cases := []struct {
+		args  []string
+		paths []string
+		opts  options
+	}{
+		{[]string{".", "-f"}, []string{"."}, options{printFiles: true}},
+		{[]string{"-fhL2", "a", "b"}, []string{"a", "b"}, options{printFiles: true, human: true, maxDepth: 2}},
+		{[]string{"a", "-L", "3", "-fJ", "b"}, []string{"a", "b"}, options{printFiles: true, maxDepth: 3, format: formatJSON}},
+		{[]string{"-I", "*.go", "x", "-fP", "*.md"}, []string{"x"}, options{printFiles: true, exclude: []string{"*.go"}, include: []string{"*.md"}}},
+		{[]string{"--du", "-dups-mark", "--sort=size", "-r", "a"}, []string{"a"}, options{du: true, dups: true, markDups: true, sortBy: sortBySize, reverse: true}},
+		{[]string{"-fI", "-x", "--", "-f", "b"}, []string{"-f", "b"}, options{printFiles: true, exclude: []string{"-x"}}},
+		{[]string{"--format", "xml", "-pugD"}, nil, options{format: formatXML, columns: columns{perms: true, user: true, group: true, date: true}}},
+	}
+	for _, c := range cases {
+		opts := options{format: formatText, links: linksFollow}
+		paths, err := parseFlags(newFlagSet("tree", &opts), c.args)
+		if err != nil {
+			t.Errorf("%q: unexpected error: %v", c.args, err)
+			continue
+		}
+		if c.opts.format == "" {
+			c.opts.format = formatText
+		}
+		c.opts.links = linksFollow
+		if !reflect.DeepEqual(paths, c.paths) || !reflect.DeepEqual(opts, c.opts) {
+			t.Errorf("%q: got %q %+v, expected %q %+v", c.args, paths, opts, c.paths, c.opts)
+		}
+	}
+}
+
+func TestRun(t *testing.T) {
+	cases := []struct {
+		args   []string
+		code   int
+		stdout string // prefix
+		stderr string // substring
+	}{
+		{[]string{"testdata/project", "-f"}, exitOK, "├───file.txt (19b)\n└───gopher.png (70372b)\n", ""},
+		{[]string{"-fh", "testdata/project", "testdata/static/css"}, exitOK,
+			"testdata/project:\n├───file.txt (19b)\n└───gopher.png (68.7KiB)\n\ntestdata/static/css:\n└───body.css (28b)\n", ""},
+		{[]string{"-f", "testdata/nowhere", "testdata/static/js"}, exitFailed,
+			"testdata/static/js:\n└───site.js (10b)\n", "testdata/nowhere: no such file or directory"},
+		{[]string{"-fJ", "testdata/project", "testdata/static/js"}, exitOK, "[\n  {\n    \"name\": \"project\"", ""},
+		{[]string{"-L", "0"}, exitUsage, "", `invalid value "0" for flag -L`},
+		{[]string{"--sort", "color"}, exitUsage, "", "not name, size, mtime, ext or version"},
+		{[]string{"-fq"}, exitUsage, "", "flag provided but not defined: -fq"},
+		{[]string{"-watch", "a", "b"}, exitUsage, "", "watch mode takes a single path"},
+		{[]string{"--help"}, exitOK, "usage: tree [flags] [path ...]", ""},
+		{[]string{"treediff", "testdata/zline", "testdata/zline"}, exitOK, "└───lorem\n", ""},
+		{[]string{"treediff", "-f", "testdata/zline", "testdata/static/z_lorem"}, exitFailed, "├───dolor.txt (empty) [added]\n", ""},
+		{[]string{"treediff", "testdata/zline"}, exitUsage, "", "needs an old and a new path"},
+		{[]string{"treediff", "testdata/zline", "testdata/nowhere"}, exitUsage, "", "no such file or directory"},
+	}
+	for _, c := range cases {
+		stdout, stderr := new(bytes.Buffer), new(bytes.Buffer)
+		code := run(c.args, stdout, stderr)
+		if code != c.code || !strings.HasPrefix(stdout.String(), c.stdout) || !strings.Contains(stderr.String(), c.stderr) {
+			t.Errorf("%q: exit %d\nGot:\n%v\nStderr:\n%v\nExpected exit %d and:\n%v", c.args, code, stdout, stderr, c.code, c.stdout)
+		}
+	}
+}
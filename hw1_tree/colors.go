@@ -0,0 +1,151 @@
+package main
+
+import (
+	"io"
+	"io/fs"
+	"os"
+	"strings"
+)
+
+// --color modes
+const (
+	colorAuto   = "auto" // only on a terminal
+	colorAlways = "always"
+	colorNever  = "never"
+)
+
+// what GNU ls uses for the keys LS_COLORS does not set
+var defaultColors = map[string]string{
+	"di": "01;34",
+	"ln": "01;36",
+	"pi": "33",
+	"so": "01;35",
+	"bd": "01;33",
+	"cd": "01;33",
+	"ex": "01;32",
+	"su": "37;41",
+	"sg": "30;43",
+	"st": "37;44",
+	"ow": "34;42",
+	"tw": "30;42",
+}
+
+// parsed LS_COLORS: "di=01;34:ln=01;36:*.tar=01;31:..."
+type lsColors struct {
+	types map[string]string // two-letter type keys -> SGR parameters
+	exts  []extColor        // "*suffix" keys, in LS_COLORS order
+}
+
+type extColor struct {
+	suffix string // lower case
+	code   string
+}
+
+func parseColors(env string) *lsColors {
+	c := &lsColors{types: make(map[string]string, len(defaultColors))}
+	for key, code := range defaultColors {
+		c.types[key] = code
+	}
+	for _, field := range strings.Split(env, ":") {
+		key, code, ok := strings.Cut(field, "=")
+		switch {
+		case !ok || key == "":
+			continue
+		case strings.HasPrefix(key, "*"):
+			c.exts = append(c.exts, extColor{suffix: strings.ToLower(key[1:]), code: code})
+		default:
+			c.types[key] = code
+		}
+	}
+	return c
+}
+
+// colors for the output, nil if it should stay plain
+func colorsFor(mode string, out io.Writer) *lsColors {
+	if mode == colorNever || mode != colorAlways && !isTerminal(out) {
+		return nil
+	}
+	return parseColors(os.Getenv("LS_COLORS"))
+}
+
+func isTerminal(out io.Writer) bool {
+	f, ok := out.(*os.File)
+	if !ok || os.Getenv("TERM") == "dumb" {
+		return false
+	}
+	info, err := f.Stat()
+	return err == nil && info.Mode()&fs.ModeCharDevice != 0
+}
+
+// nameLabel with the name painted; a nil *lsColors paints nothing
+func (c *lsColors) label(entry *dirFile) string {
+	code := c.code(entry)
+	if code == "" || strings.Trim(code, "0") == "" {
+		return nameLabel(entry)
+	}
+	name := "\x1b[" + code + "m" + entry.name + "\x1b[0m"
+	if entry.linkTarget == "" {
+		return name
+	}
+	return name + " -> " + entry.linkTarget
+}
+
+// SGR parameters for the entry, picked the way GNU ls does
+func (c *lsColors) code(entry *dirFile) string {
+	if c == nil {
+		return ""
+	}
+	key := c.key(entry)
+	if key == "fi" {
+		// extensions only color regular files
+		name := strings.ToLower(entry.name)
+		for i := len(c.exts) - 1; i >= 0; i-- { // the last one wins
+			if strings.HasSuffix(name, c.exts[i].suffix) {
+				return c.exts[i].code
+			}
+		}
+	}
+	return c.types[key]
+}
+
+func (c *lsColors) key(entry *dirFile) string {
+	if entry.linkTarget != "" && c.types["ln"] != "target" {
+		if len(entry.notes) > 0 && entry.notes[0] == noteBrokenLink && c.types["or"] != "" {
+			return "or"
+		}
+		return "ln"
+	}
+	var mode fs.FileMode
+	if entry.info != nil {
+		mode = entry.info.Mode()
+	}
+	if entry.isDir {
+		sticky, writable := mode&fs.ModeSticky != 0, mode&0002 != 0
+		switch {
+		case sticky && writable:
+			return "tw"
+		case sticky:
+			return "st"
+		case writable:
+			return "ow"
+		}
+		return "di"
+	}
+	switch {
+	case mode&fs.ModeNamedPipe != 0:
+		return "pi"
+	case mode&fs.ModeSocket != 0:
+		return "so"
+	case mode&fs.ModeCharDevice != 0:
+		return "cd"
+	case mode&fs.ModeDevice != 0:
+		return "bd"
+	case mode&fs.ModeSetuid != 0:
+		return "su"
+	case mode&fs.ModeSetgid != 0:
+		return "sg"
+	case mode&0111 != 0:
+		return "ex"
+	}
+	return "fi"
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"bytes"
+	"io/fs"
+	"os"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestColors(t *testing.T) {
+	fsys := fstest.MapFS{
+		"bin/run":    {Data: []byte("#!/bin/sh"), Mode: 0755},
+		"dead":       {Data: []byte("missing"), Mode: fs.ModeSymlink | 0777},
+		"docs/a.MD":  {Data: []byte("# a")},
+		"docs/b.txt": {Data: []byte("b")},
+		"docs/c.go":  {Data: []byte("package c")},
+		"pub":        {Mode: fs.ModeDir | fs.ModeSticky | 0777},
+	}
+	opts := options{
+		printFiles: true,
+		format:     formatText,
+		links:      linksFollow,
+		colors:     parseColors("di=01;34:or=31:*.md=35:*.txt=35:*.txt=00"),
+	}
+	out := new(bytes.Buffer)
+	if err := dirTreeFS(out, fsys, opts); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// «code|name» for the escape sequences
+	expected := strings.NewReplacer("«", "\x1b[", "|", "m", "»", "\x1b[0m").Replace(`├───«01;34|bin»
+│	└───«01;32|run» (9b)
+├───«31|dead» -> missing [broken link]
+├───«01;34|docs»
+│	├───«35|a.MD» (3b)
+│	├───b.txt (1b)
+│	└───c.go (9b)
+└───«30;42|pub»
+`)
+	if result := out.String(); result != expected {
+		t.Errorf("results not match\nGot:\n%q\nExpected:\n%q", result, expected)
+	}
+}
+
+func TestColorMode(t *testing.T) {
+	t.Setenv("LS_COLORS", "di=36")
+	cases := []struct {
+		args    []string
+		colored bool
+	}{
+		{[]string{"testdata/zline"}, false}, // auto, not a terminal
+		{[]string{"--color=never", "testdata/zline"}, false},
+		{[]string{"--color=always", "testdata/zline"}, true},
+		{[]string{"--color", "always", "-J", "testdata/zline"}, false}, // text only
+	}
+	for _, c := range cases {
+		stdout := new(bytes.Buffer)
+		if code := run(c.args, stdout, os.Stderr); code != exitOK {
+			t.Fatalf("%q: exit %d", c.args, code)
+		}
+		if colored := strings.Contains(stdout.String(), "\x1b[36mlorem\x1b[0m"); colored != c.colored {
+			t.Errorf("%q: colored %v, expected %v\n%q", c.args, colored, c.colored, stdout)
+		}
+	}
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"os/user"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const defaultTimeFormat = "Jan _2 15:04"
+
+// optional metadata columns, like tree -p -u -g -D --inodes
+type columns struct {
+	inode      bool
+	perms      bool
+	user       bool
+	group      bool
+	date       bool
+	timeFormat string // time.Format layout, "" = defaultTimeFormat
+}
+
+func (c columns) any() bool {
+	return c.inode || c.perms || c.user || c.group || c.date
+}
+
+// "[inode perms user group date] " in front of the name; notice the trailing space
+func (c columns) label(entry *dirFile) string {
+	if !c.any() {
+		return ""
+	}
+	var (
+		cols []string
+		stat fileStat
+		ok   bool
+	)
+	if entry.info != nil {
+		stat, ok = statOf(entry.info)
+	}
+	if c.inode {
+		ino := "?"
+		if ok {
+			ino = strconv.FormatUint(stat.ino, 10)
+		}
+		cols = append(cols, fmt.Sprintf("%8s", ino))
+	}
+	if c.perms {
+		perms := "??????????"
+		if entry.info != nil {
+			perms = modeString(entry.info.Mode())
+		}
+		cols = append(cols, perms)
+	}
+	if c.user {
+		name := "?"
+		if ok {
+			name = owners.user(stat.uid)
+		}
+		cols = append(cols, fmt.Sprintf("%-8s", name))
+	}
+	if c.group {
+		name := "?"
+		if ok {
+			name = owners.group(stat.gid)
+		}
+		cols = append(cols, fmt.Sprintf("%-8s", name))
+	}
+	if c.date {
+		layout := c.timeFormat
+		if layout == "" {
+			layout = defaultTimeFormat
+		}
+		date := "?"
+		if entry.info != nil {
+			date = entry.modTime.Format(layout)
+		}
+		cols = append(cols, date)
+	}
+	return "[" + strings.Join(cols, " ") + "] "
+}
+
+// ls-style "drwxr-xr-x" (os.FileMode.String differs for links and special bits)
+func modeString(mode fs.FileMode) string {
+	buf := []byte("----------")
+	switch {
+	case mode&fs.ModeDir != 0:
+		buf[0] = 'd'
+	case mode&fs.ModeSymlink != 0:
+		buf[0] = 'l'
+	case mode&fs.ModeNamedPipe != 0:
+		buf[0] = 'p'
+	case mode&fs.ModeSocket != 0:
+		buf[0] = 's'
+	case mode&fs.ModeCharDevice != 0:
+		buf[0] = 'c'
+	case mode&fs.ModeDevice != 0:
+		buf[0] = 'b'
+	}
+	const rwx = "rwxrwxrwx"
+	for i := 0; i < 9; i++ {
+		if mode&(1<<uint(8-i)) != 0 {
+			buf[i+1] = rwx[i]
+		}
+	}
+	special := func(set bool, idx int, upper, lower byte) {
+		if !set {
+			return
+		}
+		if buf[idx] == '-' {
+			buf[idx] = upper // bit set without execute
+		} else {
+			buf[idx] = lower
+		}
+	}
+	special(mode&fs.ModeSetuid != 0, 3, 'S', 's')
+	special(mode&fs.ModeSetgid != 0, 6, 'S', 's')
+	special(mode&fs.ModeSticky != 0, 9, 'T', 't')
+	return string(buf)
+}
+
+// uid/gid -> name lookups are slow (nss); remember them
+type ownerCache struct {
+	mu     sync.Mutex
+	users  map[uint32]string
+	groups map[uint32]string
+}
+
+var owners = &ownerCache{users: map[uint32]string{}, groups: map[uint32]string{}}
+
+// the numeric id if there is no such user
+func (c *ownerCache) user(uid uint32) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	name, ok := c.users[uid]
+	if !ok {
+		id := strconv.FormatUint(uint64(uid), 10)
+		name = id
+		if u, err := user.LookupId(id); err == nil {
+			name = u.Username
+		}
+		c.users[uid] = name
+	}
+	return name
+}
+
+func (c *ownerCache) group(gid uint32) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	name, ok := c.groups[gid]
+	if !ok {
+		id := strconv.FormatUint(uint64(gid), 10)
+		name = id
+		if g, err := user.LookupGroupId(id); err == nil {
+			name = g.Name
+		}
+		c.groups[gid] = name
+	}
+	return name
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"os/user"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestColumns(t *testing.T) {
+	root := makeTree(t, map[string]string{"dir/run.sh": "#!/bin/sh\n"})
+	script := filepath.Join(root, "dir", "run.sh")
+	mtime := time.Date(2021, 3, 4, 5, 6, 7, 0, time.Local)
+	for _, path := range []string{script, filepath.Join(root, "dir")} {
+		if err := os.Chtimes(path, mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Chmod(script, 0750); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(filepath.Join(root, "dir"), 0755); err != nil {
+		t.Fatal(err) // independent of the umask
+	}
+
+	opts := options{printFiles: true, format: formatText,
+		columns: columns{perms: true, date: true, timeFormat: "2006-01-02 15:04"},
+	}
+	expected := `└───[drwxr-xr-x 2021-03-04 05:06] dir
+	└───[-rwxr-x--- 2021-03-04 05:06] run.sh (10b)
+`
+	if result := treeString(t, root, opts); result != expected {
+		t.Errorf("results not match\nGot:\n%v\nExpected:\n%v", result, expected)
+	}
+
+	info, err := os.Stat(script)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stat, ok := statOf(info)
+	if !ok {
+		t.Skip("no unix stat data on this platform")
+	}
+	me, err := user.Current()
+	if err != nil {
+		t.Fatal(err)
+	}
+	group, err := user.LookupGroupId(fmt.Sprint(stat.gid))
+	if err != nil {
+		t.Fatal(err)
+	}
+	entry := newDirFile(info)
+	c := columns{inode: true, user: true, group: true}
+	expected = fmt.Sprintf("[%8d %-8s %-8s] ", stat.ino, me.Username, group.Name)
+	if result := c.label(entry); result != expected {
+		t.Errorf("got %q, expected %q", result, expected)
+	}
+	// entries that could not be read
+	if result := c.label(&dirFile{name: "x"}); result != "[       ? ?        ?       ] " {
+		t.Errorf("unexpected label %q", result)
+	}
+}
+
+func TestModeString(t *testing.T) {
+	cases := map[fs.FileMode]string{
+		0644:                                     "-rw-r--r--",
+		fs.ModeDir | 0755:                        "drwxr-xr-x",
+		fs.ModeSymlink | 0777:                    "lrwxrwxrwx",
+		fs.ModeDir | fs.ModeSticky | 0777:        "drwxrwxrwt",
+		fs.ModeSetuid | 0755:                     "-rwsr-xr-x",
+		fs.ModeSetgid | 0640:                     "-rw-r-S---",
+		fs.ModeNamedPipe | 0600:                  "prw-------",
+		fs.ModeDevice | fs.ModeCharDevice | 0666: "crw-rw-rw-",
+	}
+	for mode, expected := range cases {
+		if result := modeString(mode); result != expected {
+			t.Errorf("modeString(%v) = %q, expected %q", mode, result, expected)
+		}
+	}
+}
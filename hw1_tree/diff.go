@@ -0,0 +1,140 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// diff markers
+const (
+	diffAdded   = "added"
+	diffRemoved = "removed"
+)
+
+// print the merged tree of two roots (directories, archives or saved JSON
+// trees) with every difference marked; reports whether there were any
+func treeDiff(out io.Writer, oldPath, newPath string, opts options) (bool, error) {
+	oldTree, oldErr := loadTree(oldPath, opts)
+	if oldTree == nil {
+		return false, oldErr
+	}
+	newTree, newErr := loadTree(newPath, opts)
+	if newTree == nil {
+		return false, newErr
+	}
+	if !oldTree.isDir || !newTree.isDir {
+		return false, fmt.Errorf("treediff needs two directories")
+	}
+
+	merged, changed := diffDirs(oldTree, newTree, opts)
+	aggregate(merged) // directory totals (du)
+	if err := writeTree(out, merged, opts); err != nil {
+		return changed, err
+	}
+	// walkErrors of keep-going walks
+	if newErr != nil {
+		return changed, newErr
+	}
+	return changed, oldErr
+}
+
+// a live walk, a snapshot, or a tree saved with -J; with --hashes the
+// files of a live walk are hashed to compare against a snapshot
+func loadTree(path string, opts options) (*dirFile, error) {
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		tree, err := readJSON(f)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+		return tree, nil
+	}
+	src, err := openSource(path)
+	if err != nil {
+		return nil, err
+	}
+	defer src.Close()
+	tree, err := walkSource(src, opts)
+	if tree != nil && opts.hashes && src.tree == nil {
+		if err = mergeErrors(err, hashTree(src, tree, opts)); !partial(err) {
+			return nil, err
+		}
+	}
+	return tree, err
+}
+
+// merge two directories by entry name; reuses (and annotates) the entries
+func diffDirs(oldDir, newDir *dirFile, opts options) (*dirFile, bool) {
+	merged := &dirFile{
+		name:    newDir.name,
+		size:    newDir.size,
+		isDir:   true,
+		modTime: newDir.modTime,
+		info:    newDir.info,
+		notes:   newDir.notes,
+	}
+	oldFiles := make(map[string]*dirFile, len(oldDir.subDirFiles))
+	for _, entry := range oldDir.subDirFiles {
+		oldFiles[entry.name] = entry
+	}
+
+	changed := false
+	for _, entry := range newDir.subDirFiles {
+		oldEntry, ok := oldFiles[entry.name]
+		delete(oldFiles, entry.name)
+		switch {
+		case !ok:
+			markAll(entry, diffAdded)
+			changed = true
+		case entryType(oldEntry) != entryType(entry):
+			entry.notes = append(entry.notes, "type "+entryType(oldEntry)+" -> "+entryType(entry))
+			for _, sub := range entry.subDirFiles {
+				markAll(sub, diffAdded)
+			}
+			changed = true
+		case entry.isDir && !entry.linkOnly:
+			var dirChanged bool
+			entry, dirChanged = diffDirs(oldEntry, entry, opts)
+			changed = changed || dirChanged
+		default:
+			if oldEntry.size != entry.size {
+				entry.notes = append(entry.notes, "size "+formatSize(oldEntry.size, opts.human)+" -> "+formatSize(entry.size, opts.human))
+				changed = true
+			}
+			if oldEntry.size == entry.size && oldEntry.hash != nil && entry.hash != nil && !bytes.Equal(oldEntry.hash, entry.hash) {
+				entry.notes = append(entry.notes, "content changed")
+				changed = true
+			}
+			if oldEntry.linkTarget != entry.linkTarget {
+				entry.notes = append(entry.notes, "target "+oldEntry.linkTarget+" -> "+entry.linkTarget)
+				changed = true
+			}
+		}
+		merged.subDirFiles = append(merged.subDirFiles, entry)
+	}
+	// whatever is left is gone
+	for _, entry := range oldDir.subDirFiles {
+		if _, ok := oldFiles[entry.name]; ok {
+			markAll(entry, diffRemoved)
+			merged.subDirFiles = append(merged.subDirFiles, entry)
+			changed = true
+		}
+	}
+	return merged, changed
+}
+
+// note the entry and everything below it
+func markAll(entry *dirFile, note string) {
+	entry.notes = append(entry.notes, note)
+	for _, sub := range entry.subDirFiles {
+		markAll(sub, note)
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const testDiffResult = `├───bin
+│	├───app (7b) [size 3b -> 7b]
+│	└───debug [added]
+│		└───app.sym (3b) [added]
+├───lib [type file -> directory]
+│	└───lib.so (2b) [added]
+├───readme.txt (6b)
+└───share [removed]
+	└───doc.txt (3b) [removed]
+`
+
+func makeReleases(t *testing.T) (string, string) {
+	oldDir := makeTree(t, map[string]string{
+		"bin/app":       "v01",
+		"lib":           "so",
+		"readme.txt":    "readme",
+		"share/doc.txt": "doc",
+	})
+	newDir := makeTree(t, map[string]string{
+		"bin/app":           "v02-big",
+		"bin/debug/app.sym": "sym",
+		"lib/lib.so":        "so",
+		"readme.txt":        "README",
+	})
+	return oldDir, newDir
+}
+
+func TestTreeDiff(t *testing.T) {
+	oldDir, newDir := makeReleases(t)
+	out := new(bytes.Buffer)
+	changed, err := treeDiff(out, oldDir, newDir, options{printFiles: true, format: formatText})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !changed {
+		t.Errorf("expected changes")
+	}
+	if result := out.String(); result != testDiffResult {
+		t.Errorf("results not match\nGot:\n%v\nExpected:\n%v", result, testDiffResult)
+	}
+
+	out.Reset()
+	changed, err = treeDiff(out, newDir, newDir, options{format: formatText})
+	if err != nil || changed {
+		t.Errorf("expected no changes, got %v, %v", changed, err)
+	}
+}
+
+// a tree saved with -J works as the old side
+func TestTreeDiffSnapshot(t *testing.T) {
+	oldDir, newDir := makeReleases(t)
+	snapshot := filepath.Join(t.TempDir(), "old.json")
+	saved := new(bytes.Buffer)
+	if err := dirTreeWith(saved, oldDir, options{printFiles: true, format: formatJSON}); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(snapshot, saved.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	out := new(bytes.Buffer)
+	changed, err := treeDiff(out, snapshot, newDir, options{printFiles: true, format: formatText})
+	if err != nil || !changed {
+		t.Fatalf("expected changes, got %v, %v", changed, err)
+	}
+	if result := out.String(); result != testDiffResult {
+		t.Errorf("results not match\nGot:\n%v\nExpected:\n%v", result, testDiffResult)
+	}
+}
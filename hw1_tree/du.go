@@ -0,0 +1,55 @@
+package main
+
+import "fmt"
+
+// fill in totalSize and fileCount bottom-up
+func aggregate(root *dirFile) {
+	if !root.isDir {
+		root.totalSize = root.size
+		root.fileCount = 1
+		return
+	}
+	root.totalSize, root.fileCount = 0, 0
+	for _, entry := range root.subDirFiles {
+		aggregate(entry)
+		root.totalSize += entry.totalSize
+		root.fileCount += entry.fileCount
+	}
+}
+
+var sizeUnits = []string{"KiB", "MiB", "GiB", "TiB", "PiB"}
+
+// 70372 -> "70372b" or, human readable, "68.7KiB"
+func formatSize(size int64, human bool) string {
+	if !human || size < 1024 {
+		return fmt.Sprintf("%db", size)
+	}
+	value := float64(size) / 1024
+	unit := 0
+	for value >= 1024 && unit < len(sizeUnits)-1 {
+		value /= 1024
+		unit++
+	}
+	return fmt.Sprintf("%.1f%s", value, sizeUnits[unit])
+}
+
+// the " (...)" suffix after the entry name; notice the leading space
+func sizeLabel(entry *dirFile, opts options) string {
+	if entry.linkOnly {
+		return "" // the size of the link itself says nothing
+	}
+	if !entry.isDir && entry.size == 0 {
+		return " (empty)"
+	}
+	if !entry.isDir {
+		return " (" + formatSize(entry.size, opts.human) + ")"
+	}
+	if !opts.du {
+		return ""
+	}
+	files := "files"
+	if entry.fileCount == 1 {
+		files = "file"
+	}
+	return fmt.Sprintf(" (%s, %d %s)", formatSize(entry.totalSize, opts.human), entry.fileCount, files)
+}
@@ -0,0 +1,41 @@
+package main
+
+import "testing"
+
+const testDuResult = `├───project (70391b, 2 files)
+├───static (281583b, 10 files)
+│	├───a_lorem (140744b, 3 files)
+│	├───css (28b, 1 file)
+│	├───html (57b, 1 file)
+│	├───js (10b, 1 file)
+│	└───z_lorem (140744b, 3 files)
+└───zline (140744b, 4 files)
+	└───lorem (140744b, 3 files)
+`
+
+func TestTreeDu(t *testing.T) {
+	result := treeString(t, "testdata", options{format: formatText, du: true, maxDepth: 2})
+	if result != testDuResult {
+		t.Errorf("results not match\nGot:\n%v\nExpected:\n%v", result, testDuResult)
+	}
+}
+
+func TestFormatSize(t *testing.T) {
+	cases := []struct {
+		size     int64
+		human    bool
+		expected string
+	}{
+		{0, true, "0b"},
+		{1023, true, "1023b"},
+		{70372, false, "70372b"},
+		{70372, true, "68.7KiB"},
+		{5 << 20, true, "5.0MiB"},
+		{3<<30 + 512<<20, true, "3.5GiB"},
+	}
+	for _, c := range cases {
+		if result := formatSize(c.size, c.human); result != c.expected {
+			t.Errorf("formatSize(%d, %v) = %q, expected %q", c.size, c.human, result, c.expected)
+		}
+	}
+}
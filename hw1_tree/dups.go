@@ -0,0 +1,168 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+)
+
+// files bigger than this are compared by their head before being hashed in full
+const partialHashSize = 4 << 10
+
+// files with identical content
+type dupSet struct {
+	size  int64
+	files []*dupFile // sorted by path
+}
+
+type dupFile struct {
+	entry *dirFile
+	rel   string
+}
+
+// space freed by keeping a single copy
+func (set dupSet) reclaimable() int64 {
+	return set.size * int64(len(set.files)-1)
+}
+
+// group candidates by size, then by a hash of the head, then by a full hash
+func findDuplicates(src *source, root *dirFile, opts options) ([]dupSet, error) {
+	if err := src.needFiles(); err != nil {
+		return nil, err
+	}
+	bySize := map[int64][]*dupFile{}
+	seen := map[fileID]bool{} // hard links (and followed symlinks) are no duplicates
+	var collect func(dir *dirFile, rel string)
+	collect = func(dir *dirFile, rel string) {
+		for _, entry := range dir.subDirFiles {
+			entryRel := joinRel(rel, entry.name)
+			switch {
+			case entry.isDir && !entry.linkOnly:
+				collect(entry, entryRel)
+			case entry.isDir, entry.linkOnly, entry.info == nil, entry.size == 0:
+				// nothing to compare (or nothing to reclaim)
+			default:
+				if id, ok := identify(entry.info); ok {
+					if seen[id] {
+						continue
+					}
+					seen[id] = true
+				}
+				bySize[entry.size] = append(bySize[entry.size], &dupFile{entry: entry, rel: entryRel})
+			}
+		}
+	}
+	collect(root, "")
+
+	var sets []dupSet
+	for size, files := range bySize {
+		if len(files) < 2 {
+			continue
+		}
+		groups := [][]*dupFile{files}
+		if size > partialHashSize {
+			var err error
+			if groups, err = groupByHash(src, groups, partialHashSize, opts); err != nil {
+				return nil, err
+			}
+		}
+		groups, err := groupByHash(src, groups, -1, opts)
+		if err != nil {
+			return nil, err
+		}
+		for _, group := range groups {
+			sort.Slice(group, func(i, j int) bool {
+				return group[i].rel < group[j].rel
+			})
+			sets = append(sets, dupSet{size: size, files: group})
+		}
+	}
+	// most space to win first
+	sort.Slice(sets, func(i, j int) bool {
+		if sets[i].reclaimable() != sets[j].reclaimable() {
+			return sets[i].reclaimable() > sets[j].reclaimable()
+		}
+		return sets[i].files[0].rel < sets[j].files[0].rel
+	})
+	return sets, nil
+}
+
+// split every group by the hash of the first limit bytes (-1: everything);
+// groups of one are dropped
+func groupByHash(src *source, groups [][]*dupFile, limit int64, opts options) ([][]*dupFile, error) {
+	var result [][]*dupFile
+	for _, group := range groups {
+		byHash := map[[sha256.Size]byte][]*dupFile{}
+		var order [][sha256.Size]byte // deterministic output
+		for _, file := range group {
+			sum, err := hashFile(src.fsys, path.Join(src.root, file.rel), limit)
+			if err != nil {
+				if opts.keepGoing {
+					continue // not comparable, not a duplicate
+				}
+				return nil, err
+			}
+			if _, ok := byHash[sum]; !ok {
+				order = append(order, sum)
+			}
+			byHash[sum] = append(byHash[sum], file)
+		}
+		for _, sum := range order {
+			if len(byHash[sum]) > 1 {
+				result = append(result, byHash[sum])
+			}
+		}
+	}
+	return result, nil
+}
+
+func hashFile(fsys fs.FS, name string, limit int64) ([sha256.Size]byte, error) {
+	var sum [sha256.Size]byte
+	f, err := fsys.Open(name)
+	if err != nil {
+		return sum, err
+	}
+	defer f.Close()
+
+	var r io.Reader = f
+	if limit >= 0 {
+		r = io.LimitReader(f, limit)
+	}
+	h := sha256.New()
+	if _, err := io.Copy(h, r); err != nil {
+		return sum, err
+	}
+	copy(sum[:], h.Sum(nil))
+	return sum, nil
+}
+
+// "[dup #n]" on every member of set n
+func markDuplicates(sets []dupSet) {
+	for idx, set := range sets {
+		for _, file := range set.files {
+			file.entry.notes = append(file.entry.notes, "dup #"+strconv.Itoa(idx+1))
+		}
+	}
+}
+
+// the report printed after the tree
+func writeDuplicates(out io.Writer, sets []dupSet, human bool) {
+	var total int64
+	for _, set := range sets {
+		total += set.reclaimable()
+	}
+	buf := new(bytes.Buffer)
+	fmt.Fprintf(buf, "\n%d duplicate set(s), %s reclaimable\n", len(sets), formatSize(total, human))
+	for idx, set := range sets {
+		fmt.Fprintf(buf, "#%d: %d x %s, %s reclaimable\n", idx+1, len(set.files), formatSize(set.size, human), formatSize(set.reclaimable(), human))
+		for _, file := range set.files {
+			fmt.Fprintf(buf, "\t%s\n", file.rel)
+		}
+	}
+	out.Write(buf.Bytes())
+}
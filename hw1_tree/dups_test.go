@@ -0,0 +1,84 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDuplicates(t *testing.T) {
+	head := strings.Repeat("x", partialHashSize)
+	root := makeTree(t, map[string]string{
+		"a/big.bin":   head + "tail-1",
+		"b/big.bin":   head + "tail-1",
+		"c/big.bin":   head + "tail-2", // same size and head, other content
+		"a/small.txt": "hello",
+		"b/small.txt": "hello",
+		"b/other.txt": "world", // same size, other content
+		"empty1":      "",
+		"empty2":      "",
+	})
+	// a hard link is the same file, not a copy
+	if err := os.Link(filepath.Join(root, "a", "small.txt"), filepath.Join(root, "c", "small.txt")); err != nil {
+		t.Fatal(err)
+	}
+
+	out := new(bytes.Buffer)
+	opts := options{printFiles: true, format: formatText, dups: true, markDups: true}
+	if err := dirTreeWith(out, root, opts); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := `├───a
+│	├───big.bin (4102b) [dup #1]
+│	└───small.txt (5b) [dup #2]
+├───b
+│	├───big.bin (4102b) [dup #1]
+│	├───other.txt (5b)
+│	└───small.txt (5b) [dup #2]
+├───c
+│	├───big.bin (4102b)
+│	└───small.txt (5b)
+├───empty1 (empty)
+└───empty2 (empty)
+
+2 duplicate set(s), 4107b reclaimable
+#1: 2 x 4102b, 4102b reclaimable
+	a/big.bin
+	b/big.bin
+#2: 2 x 5b, 5b reclaimable
+	a/small.txt
+	b/small.txt
+`
+	if result := out.String(); result != expected {
+		t.Errorf("results not match\nGot:\n%v\nExpected:\n%v", result, expected)
+	}
+}
+
+func TestDuplicatesTestdata(t *testing.T) {
+	src, err := openSource("testdata")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tree, err := walkSource(src, options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sets, err := findDuplicates(src, tree, options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sets) != 1 || len(sets[0].files) != 7 || sets[0].reclaimable() != 6*70372 {
+		t.Errorf("expected the 7 gophers, got %+v", sets)
+	}
+}
+
+func TestDuplicatesNone(t *testing.T) {
+	out := new(bytes.Buffer)
+	writeDuplicates(out, nil, true)
+	expected := "\n0 duplicate set(s), 0b reclaimable\n"
+	if result := out.String(); result != expected {
+		t.Errorf("results not match\nGot:\n%v\nExpected:\n%v", result, expected)
+	}
+}
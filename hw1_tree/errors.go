@@ -0,0 +1,68 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+)
+
+// an entry that could not be read
+type walkError struct {
+	path string
+	err  error
+}
+
+// everything a keep-going walk skipped
+type walkErrors []walkError
+
+func (errs walkErrors) Error() string {
+	if len(errs) == 1 {
+		return fmt.Sprintf("%s: %s", errs[0].path, errorLabel(errs[0].err))
+	}
+	return fmt.Sprintf("%d entries could not be read", len(errs))
+}
+
+// nil, or what a keep-going walk skipped: the tree is worth showing either way
+func partial(err error) bool {
+	_, ok := err.(walkErrors)
+	return err == nil || ok
+}
+
+// list every failure, one per line
+func (errs walkErrors) summary(out io.Writer) {
+	fmt.Fprintf(out, "%d error(s):\n", len(errs))
+	for _, e := range errs {
+		fmt.Fprintf(out, "  %s: %s\n", e.path, errorLabel(e.err))
+	}
+}
+
+// "open /x/y: permission denied" -> "permission denied"
+func errorLabel(err error) string {
+	var pathErr *fs.PathError
+	if errors.As(err, &pathErr) {
+		return pathErr.Err.Error()
+	}
+	return err.Error()
+}
+
+// without keep-going the error ends the walk; otherwise it is noted on the
+// entry, remembered for the summary and the walk goes on
+func (w *walker) fail(entry *dirFile, rel string, err error) error {
+	if !w.opts.keepGoing {
+		return err
+	}
+	entry.notes = append(entry.notes, errorLabel(err))
+	w.mu.Lock()
+	w.errs = append(w.errs, walkError{path: w.src.display(w.fsName(rel)), err: err})
+	w.mu.Unlock()
+	return nil
+}
+
+// forget what failed so far: a watch has it on the entries already and runs
+// for as long as it is left alone
+func (w *walker) clearErrs() {
+	w.mu.Lock()
+	w.errs = nil
+	w.mu.Unlock()
+}
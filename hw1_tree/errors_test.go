@@ -0,0 +1,71 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+func TestKeepGoing(t *testing.T) {
+	if os.Geteuid() == 0 {
+		t.Skip("root can open any directory")
+	}
+	root := makeTree(t, map[string]string{
+		"a/file.txt":      "a",
+		"locked/file.txt": "b",
+		"z/file.txt":      "c",
+	})
+	locked := filepath.Join(root, "locked")
+	if err := os.Chmod(locked, 0); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chmod(locked, 0755)
+
+	for _, workers := range []int{1, 4} {
+		out := new(bytes.Buffer)
+		opts := options{printFiles: true, format: formatText, keepGoing: true, workers: workers}
+		err := dirTreeWith(out, root, opts)
+		errs, ok := err.(walkErrors)
+		if !ok || len(errs) != 1 || errs[0].path != locked {
+			t.Fatalf("expected one error for %s, got %v", locked, err)
+		}
+		expected := `├───a
+│	└───file.txt (1b)
+├───locked [permission denied]
+└───z
+	└───file.txt (1b)
+`
+		if result := out.String(); result != expected {
+			t.Errorf("results not match\nGot:\n%v\nExpected:\n%v", result, expected)
+		}
+	}
+
+	// without -k the first error still ends the walk
+	if err := dirTreeWith(new(bytes.Buffer), root, options{format: formatText}); err == nil {
+		t.Errorf("expected an error")
+	}
+}
+
+func TestWalkErrorsSummary(t *testing.T) {
+	errs := walkErrors{
+		{path: "/srv/a", err: &fs.PathError{Op: "open", Path: "/srv/a", Err: syscall.EACCES}},
+		{path: "/srv/b", err: errors.New("boom")},
+	}
+	if errs.Error() != "2 entries could not be read" {
+		t.Errorf("unexpected message %q", errs.Error())
+	}
+	if msg := errs[:1].Error(); msg != "/srv/a: permission denied" {
+		t.Errorf("unexpected message %q", msg)
+	}
+
+	out := new(bytes.Buffer)
+	errs.summary(out)
+	expected := "2 error(s):\n  /srv/a: permission denied\n  /srv/b: boom\n"
+	if out.String() != expected {
+		t.Errorf("results not match\nGot:\n%v\nExpected:\n%v", out.String(), expected)
+	}
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// slash-separated path of name inside rel
+func joinRel(rel, name string) string {
+	if rel == "" {
+		return name
+	}
+	return rel + "/" + name
+}
+
+// reject malformed patterns up front instead of silently matching nothing
+func checkGlob(pattern string) error {
+	if _, err := path.Match(pattern, ""); err != nil {
+		return fmt.Errorf("bad pattern %q: %v", pattern, err)
+	}
+	return nil
+}
+
+// patterns with a slash are matched against the relative path, the rest against the name
+func matchAny(patterns []string, rel string) bool {
+	for _, pattern := range patterns {
+		subject := path.Base(rel)
+		if strings.Contains(pattern, "/") {
+			subject = rel
+		}
+		if matchGlob(pattern, subject) {
+			return true
+		}
+	}
+	return false
+}
+
+// like path.Match, but "**" matches any number of path segments
+func matchGlob(pattern, name string) bool {
+	return matchSegments(strings.Split(pattern, "/"), strings.Split(name, "/"))
+}
+
+func matchSegments(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			// try to swallow 0..n segments
+			for i := 0; i <= len(name); i++ {
+				if matchSegments(pattern[1:], name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(name) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], name[0]); !ok {
+			return false
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0
+}
+
+// should the entry be left out of the tree (and never be opened)?
+func (opts options) pruned(rel string, isDir bool, ignores ignoreRules) bool {
+	if matchAny(opts.exclude, rel) {
+		return true
+	}
+	if !isDir && len(opts.include) > 0 && !matchAny(opts.include, rel) {
+		return true
+	}
+	return opts.gitignore && ignores.ignored(rel, isDir)
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// create files (path -> content) below a fresh temporary directory;
+// a path ending in "/" creates an empty directory
+func makeTree(t testing.TB, files map[string]string) string {
+	root := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		if strings.HasSuffix(name, "/") {
+			if err := os.MkdirAll(path, 0755); err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return root
+}
+
+func treeString(t *testing.T, path string, opts options) string {
+	out := new(bytes.Buffer)
+	if err := dirTreeWith(out, path, opts); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return out.String()
+}
+
+func TestTreeExcludeInclude(t *testing.T) {
+	root := makeTree(t, map[string]string{
+		"main.go":                 "package main",
+		"README.md":               "# readme",
+		"vendor/lib/lib.go":       "package lib",
+		"node_modules/x/index.js": "x",
+		"cmd/tool/tool.go":        "package tool",
+		"cmd/tool/notes.txt":      "notes",
+	})
+
+	opts := options{printFiles: true, format: formatText,
+		exclude: []string{"vendor", "node_modules"},
+		include: []string{"*.go"},
+	}
+	expected := `├───cmd
+│	└───tool
+│		└───tool.go (12b)
+└───main.go (12b)
+`
+	if result := treeString(t, root, opts); result != expected {
+		t.Errorf("results not match\nGot:\n%v\nExpected:\n%v", result, expected)
+	}
+
+	// patterns with a slash match the path relative to the root
+	opts = options{printFiles: true, format: formatText,
+		exclude: []string{"cmd/*/notes.txt", "**/index.js", "vendor", "*.md"},
+	}
+	expected = `├───cmd
+│	└───tool
+│		└───tool.go (12b)
+├───main.go (12b)
+└───node_modules
+	└───x
+`
+	if result := treeString(t, root, opts); result != expected {
+		t.Errorf("results not match\nGot:\n%v\nExpected:\n%v", result, expected)
+	}
+}
+
+func TestTreeGitignore(t *testing.T) {
+	root := makeTree(t, map[string]string{
+		".gitignore":          "# build output\n*.log\n/build/\n!keep.log\n",
+		".git/HEAD":           "ref: refs/heads/master",
+		"app.log":             "log",
+		"keep.log":            "kept",
+		"build/out.bin":       "bin",
+		"src/build/gen.go":    "package build",
+		"src/.gitignore":      "gen_*.go\n!gen_keep.go\ndocs/\n",
+		"src/gen_a.go":        "package src",
+		"src/gen_keep.go":     "package src",
+		"src/docs/index.html": "<html>",
+		"src/main.go":         "package src",
+	})
+
+	opts := options{printFiles: true, format: formatText, gitignore: true}
+	expected := `├───.gitignore (39b)
+├───keep.log (4b)
+└───src
+	├───.gitignore (28b)
+	├───build
+	│	└───gen.go (13b)
+	├───gen_keep.go (11b)
+	└───main.go (11b)
+`
+	if result := treeString(t, root, opts); result != expected {
+		t.Errorf("results not match\nGot:\n%v\nExpected:\n%v", result, expected)
+	}
+}
+
+func TestTreePrunedNotOpened(t *testing.T) {
+	if os.Geteuid() == 0 {
+		t.Skip("root can open any directory")
+	}
+	root := makeTree(t, map[string]string{"secret/key": "x", "open/file": "y"})
+	secret := filepath.Join(root, "secret")
+	if err := os.Chmod(secret, 0); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chmod(secret, 0755)
+
+	opts := options{format: formatText, exclude: []string{"secret"}}
+	if result := treeString(t, root, opts); result != "└───open\n" {
+		t.Errorf("unexpected result:\n%v", result)
+	}
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"io"
+)
+
+// entry types as they appear in the structured output
+const (
+	typeDir  = "directory"
+	typeFile = "file"
+	typeLink = "link" // not followed
+)
+
+// serializable mirror of dirFile (JSON + XML)
+type treeNode struct {
+	XMLName  xml.Name    `json:"-" xml:"entry"`
+	Name     string      `json:"name" xml:"name,attr"`
+	Type     string      `json:"type" xml:"type,attr"`
+	Size     int64       `json:"size" xml:"size,attr"`
+	Target   string      `json:"target,omitempty" xml:"target,attr,omitempty"` // symlinks only
+	Notes    []string    `json:"notes,omitempty" xml:"note"`
+	Total    *int64      `json:"total,omitempty" xml:"total,attr,omitempty"` // du only
+	Files    *int        `json:"files,omitempty" xml:"files,attr,omitempty"` // du only
+	Children []*treeNode `json:"children,omitempty" xml:"entry"`
+}
+
+// convert the file tree, honoring the options the same way printTreeFile does
+func buildNode(root *dirFile, opts options, depth int) *treeNode {
+	node := &treeNode{
+		Name:   root.name,
+		Type:   entryType(root),
+		Size:   root.size,
+		Target: root.linkTarget,
+		Notes:  root.notes,
+	}
+	if node.Type != typeDir {
+		return node
+	}
+
+	if opts.du {
+		node.Total, node.Files = &root.totalSize, &root.fileCount
+	}
+	if opts.maxDepth > 0 && depth > opts.maxDepth {
+		return node
+	}
+	files := root.subDirFiles // alias
+	sortFiles(files, opts)
+	for _, entry := range files {
+		if !entry.isDir && !opts.printFiles {
+			continue
+		}
+		node.Children = append(node.Children, buildNode(entry, opts, depth+1))
+	}
+	return node
+}
+
+func entryType(entry *dirFile) string {
+	switch {
+	case entry.linkOnly:
+		return typeLink
+	case entry.isDir:
+		return typeDir
+	}
+	return typeFile
+}
+
+func writeJSON(out io.Writer, root *dirFile, opts options) error {
+	enc := json.NewEncoder(out)
+	enc.SetIndent("", "  ")
+	return enc.Encode(buildNode(root, opts, 1))
+}
+
+func writeXML(out io.Writer, root *dirFile, opts options) error {
+	if _, err := io.WriteString(out, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(out)
+	enc.Indent("", "  ")
+	if err := enc.Encode(buildNode(root, opts, 1)); err != nil {
+		return err
+	}
+	_, err := io.WriteString(out, "\n")
+	return err
+}
+
+// the reverse of writeJSON: a saved tree, printable like a live one
+func readJSON(in io.Reader) (*dirFile, error) {
+	node := &treeNode{}
+	if err := json.NewDecoder(in).Decode(node); err != nil {
+		return nil, err
+	}
+	return node.dirFile(), nil
+}
+
+func (node *treeNode) dirFile() *dirFile {
+	entry := &dirFile{
+		name:       node.Name,
+		size:       node.Size,
+		isDir:      node.Type == typeDir,
+		linkTarget: node.Target,
+		linkOnly:   node.Type == typeLink,
+		notes:      node.Notes,
+	}
+	for _, child := range node.Children {
+		entry.subDirFiles = append(entry.subDirFiles, child.dirFile())
+	}
+	return entry
+}
+
+// several roots in one document: a JSON array, <tree> around the XML entries
+// or one section per root on the HTML page
+func writeTrees(out io.Writer, trees []*dirFile, opts options) error {
+	if opts.format == formatHTML {
+		return writeHTML(out, trees, opts)
+	}
+	if opts.format == formatSnapshot {
+		return errors.New("a snapshot holds a single tree")
+	}
+	nodes := make([]*treeNode, len(trees))
+	for i, tree := range trees {
+		nodes[i] = buildNode(tree, opts, 1)
+	}
+	if opts.format == formatJSON {
+		enc := json.NewEncoder(out)
+		enc.SetIndent("", "  ")
+		return enc.Encode(nodes)
+	}
+	if _, err := io.WriteString(out, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(out)
+	enc.Indent("", "  ")
+	err := enc.Encode(struct {
+		XMLName xml.Name    `xml:"tree"`
+		Entries []*treeNode `xml:"entry"`
+	}{Entries: nodes})
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(out, "\n")
+	return err
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"testing"
+)
+
+// flatten a structured tree into "path type size" lines for easy comparison
+func flattenNode(node *treeNode, prefix string, lines *[]string) {
+	for _, child := range node.Children {
+		path := prefix + child.Name
+		*lines = append(*lines, path+" "+child.Type)
+		flattenNode(child, path+"/", lines)
+	}
+}
+
+func TestTreeJSON(t *testing.T) {
+	out := new(bytes.Buffer)
+	err := dirTreeWith(out, "testdata", options{printFiles: false, format: formatJSON})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	root := &treeNode{}
+	if err := json.Unmarshal(out.Bytes(), root); err != nil {
+		t.Fatalf("invalid JSON: %v\n%s", err, out.String())
+	}
+	if root.Name != "testdata" || root.Type != typeDir {
+		t.Errorf("unexpected root: %+v", root)
+	}
+
+	var lines []string
+	flattenNode(root, "", &lines)
+	expected := []string{
+		"project directory",
+		"static directory",
+		"static/a_lorem directory",
+		"static/a_lorem/ipsum directory",
+		"static/css directory",
+		"static/html directory",
+		"static/js directory",
+		"static/z_lorem directory",
+		"static/z_lorem/ipsum directory",
+		"zline directory",
+		"zline/lorem directory",
+		"zline/lorem/ipsum directory",
+	}
+	if len(lines) != len(expected) {
+		t.Fatalf("results not match\nGot:\n%v\nExpected:\n%v", lines, expected)
+	}
+	for i := range lines {
+		if lines[i] != expected[i] {
+			t.Errorf("line %d: got %q, expected %q", i, lines[i], expected[i])
+		}
+	}
+}
+
+func TestTreeXML(t *testing.T) {
+	out := new(bytes.Buffer)
+	err := dirTreeWith(out, "testdata/project", options{printFiles: true, format: formatXML})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	root := &treeNode{}
+	if err := xml.Unmarshal(out.Bytes(), root); err != nil {
+		t.Fatalf("invalid XML: %v\n%s", err, out.String())
+	}
+	if root.Name != "project" || len(root.Children) != 2 {
+		t.Fatalf("unexpected root: %+v", root)
+	}
+	file := root.Children[0]
+	if file.Name != "file.txt" || file.Type != typeFile || file.Size != 19 {
+		t.Errorf("unexpected entry: %+v", file)
+	}
+	if gopher := root.Children[1]; gopher.Name != "gopher.png" || gopher.Size != 70372 {
+		t.Errorf("unexpected entry: %+v", gopher)
+	}
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"io/fs"
+	"path"
+	"strings"
+)
+
+// one line of a .gitignore file
+type ignorePattern struct {
+	base     string // directory holding the .gitignore, relative to the root
+	glob     string // slash-separated pattern
+	negate   bool   // "!pattern" re-includes
+	dirOnly  bool   // "pattern/" only matches directories
+	anchored bool   // pattern contains a slash: match the path below base, not just the name
+}
+
+// every pattern in effect for a directory, outermost .gitignore first
+type ignoreRules []ignorePattern
+
+// parse one .gitignore file; base is where it lives relative to the root
+func parseIgnore(r io.Reader, base string) (ignoreRules, error) {
+	var rules ignoreRules
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), " \t\r")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		p := ignorePattern{base: base}
+		if strings.HasPrefix(line, "!") {
+			p.negate = true
+			line = line[1:]
+		} else if strings.HasPrefix(line, `\#`) || strings.HasPrefix(line, `\!`) {
+			line = line[1:] // escaped literal
+		}
+		if strings.HasSuffix(line, "/") {
+			p.dirOnly = true
+			line = strings.TrimRight(line, "/")
+		}
+		if strings.Contains(line, "/") {
+			p.anchored = true
+			line = strings.TrimPrefix(line, "/")
+		}
+		if line == "" || checkGlob(line) != nil {
+			continue // git skips what it can not parse, so do we
+		}
+		p.glob = line
+		rules = append(rules, p)
+	}
+	return rules, scanner.Err()
+}
+
+// rules for the directory name in fsys: the inherited ones plus its own .gitignore
+func (rules ignoreRules) load(fsys fs.FS, name, rel string) (ignoreRules, error) {
+	f, err := fsys.Open(path.Join(name, ".gitignore"))
+	if errors.Is(err, fs.ErrNotExist) {
+		return rules, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	own, err := parseIgnore(f, rel)
+	if err != nil || len(own) == 0 {
+		return rules, err
+	}
+	// never append in place: sibling directories share the parent's slice
+	merged := make(ignoreRules, 0, len(rules)+len(own))
+	return append(append(merged, rules...), own...), nil
+}
+
+// the last matching pattern wins, deeper .gitignore files come last
+func (rules ignoreRules) ignored(rel string, isDir bool) bool {
+	if isDir && (rel == ".git" || strings.HasSuffix(rel, "/.git")) {
+		return true // git never tracks its own metadata
+	}
+	ignored := false
+	for _, p := range rules {
+		if p.matches(rel, isDir) {
+			ignored = !p.negate
+		}
+	}
+	return ignored
+}
+
+func (p ignorePattern) matches(rel string, isDir bool) bool {
+	if p.dirOnly && !isDir {
+		return false
+	}
+	if p.base != "" {
+		if !strings.HasPrefix(rel, p.base+"/") {
+			return false
+		}
+		rel = rel[len(p.base)+1:]
+	}
+	if !p.anchored {
+		rel = rel[strings.LastIndex(rel, "/")+1:] // name only
+	}
+	return matchGlob(p.glob, rel)
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/fs"
+	"math"
+	"path"
+	"regexp"
+	"runtime"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+const (
+	defaultGrepMaxSize = 10 << 20 // larger files are not searched
+	binarySniffSize    = 8000     // a NUL byte in here makes a file binary, as for git and grep
+)
+
+// one file to search
+type grepJob struct {
+	entry   *dirFile
+	rel     string
+	matches int
+	err     error
+}
+
+func checkGrep(opts options) error {
+	if opts.grep != nil && opts.watch {
+		return errors.New("--grep can not be combined with --watch")
+	}
+	return nil
+}
+
+// search the files of the walked tree in parallel and prune it down to the
+// matching ones and the directories leading to them; failures end the search
+// unless keep-going, which notes them on the entries and returns walkErrors
+func grepTree(src *source, root *dirFile, opts options) error {
+	if err := src.needFiles(); err != nil {
+		return err
+	}
+	var jobs []*grepJob
+	collectGrepJobs(root, "", &jobs)
+
+	maxSize := opts.grepMaxSize
+	if maxSize <= 0 {
+		maxSize = defaultGrepMaxSize
+	}
+	workers := opts.workers
+	if workers <= 1 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	queue := make(chan *grepJob)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range queue {
+				job.matches, job.err = grepFile(src.fsys, path.Join(src.root, job.rel), opts.grep, maxSize)
+			}
+		}()
+	}
+	for _, job := range jobs {
+		queue <- job
+	}
+	close(queue)
+	wg.Wait()
+
+	var errs walkErrors
+	keep := make(map[*dirFile]bool)
+	for _, job := range jobs { // in walk order
+		switch {
+		case job.err != nil && !opts.keepGoing:
+			return job.err
+		case job.err != nil:
+			// could not be searched: stays in the tree, marked
+			job.entry.notes = append(job.entry.notes, errorLabel(job.err))
+			errs = append(errs, walkError{path: src.display(path.Join(src.root, job.rel)), err: job.err})
+			keep[job.entry] = true
+		case job.matches > 0:
+			job.entry.notes = append(job.entry.notes, matchLabel(job.matches))
+			keep[job.entry] = true
+		}
+	}
+	pruneUnmatched(root, keep)
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// every regular file that would be listed
+func collectGrepJobs(dir *dirFile, rel string, jobs *[]*grepJob) {
+	for _, entry := range dir.subDirFiles {
+		entryRel := joinRel(rel, entry.name)
+		switch {
+		case entry.linkOnly:
+		case entry.isDir:
+			collectGrepJobs(entry, entryRel, jobs)
+		case entry.info != nil && entry.info.Mode().IsRegular():
+			*jobs = append(*jobs, &grepJob{entry: entry, rel: entryRel})
+		}
+	}
+}
+
+// number of matching lines; 0 for binary and oversized files
+func grepFile(fsys fs.FS, name string, re *regexp.Regexp, maxSize int64) (int, error) {
+	f, err := fsys.Open(name)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	data, err := io.ReadAll(io.LimitReader(f, maxSize+1))
+	if err != nil {
+		return 0, err
+	}
+	if int64(len(data)) > maxSize || bytes.IndexByte(data[:min(len(data), binarySniffSize)], 0) >= 0 {
+		return 0, nil
+	}
+	matches := 0
+	for len(data) > 0 {
+		line := data
+		if idx := bytes.IndexByte(data, '\n'); idx >= 0 {
+			line, data = data[:idx], data[idx+1:]
+		} else {
+			data = nil
+		}
+		if re.Match(line) {
+			matches++
+		}
+	}
+	return matches, nil
+}
+
+func matchLabel(matches int) string {
+	if matches == 1 {
+		return "1 match"
+	}
+	return strconv.Itoa(matches) + " matches"
+}
+
+// keep the given files and the directories holding any; reports whether
+// anything is left below dir
+func pruneUnmatched(dir *dirFile, keep map[*dirFile]bool) bool {
+	kept := dir.subDirFiles[:0]
+	for _, entry := range dir.subDirFiles {
+		if keep[entry] || entry.isDir && !entry.linkOnly && pruneUnmatched(entry, keep) {
+			kept = append(kept, entry)
+		}
+	}
+	clear(dir.subDirFiles[len(kept):]) // let the dropped entries go
+	dir.subDirFiles = kept
+	return len(kept) > 0
+}
+
+// "512", "64K", "10M", "1G" (powers of 1024)
+func parseSize(s string) (int64, error) {
+	var shift uint
+	if n := len(s); n > 1 {
+		switch s[n-1] {
+		case 'K', 'k':
+			shift = 10
+		case 'M', 'm':
+			shift = 20
+		case 'G', 'g':
+			shift = 30
+		}
+		if shift > 0 {
+			s = s[:n-1]
+		}
+	}
+	size, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || size < 1 || size > math.MaxInt64>>shift {
+		return 0, errors.New("not a size like 512, 64K, 10M or 1G")
+	}
+	return size << shift, nil
+}
+
+// merge the failures of the walk and of a pass over its files (search,
+// hashes), sorted like walkSource does
+func mergeErrors(walkErr, passErr error) error {
+	if passErr == nil || !partial(walkErr) {
+		return walkErr
+	}
+	passErrs, ok := passErr.(walkErrors)
+	if !ok {
+		return passErr
+	}
+	errs, _ := walkErr.(walkErrors)
+	errs = append(append(walkErrors{}, errs...), passErrs...)
+	sort.Slice(errs, func(i, j int) bool {
+		return errs[i].path < errs[j].path
+	})
+	return errs
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"bytes"
+	"io/fs"
+	"regexp"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestGrep(t *testing.T) {
+	root := makeTree(t, map[string]string{
+		"README.md":          "TODO: write the readme\n",
+		"docs/guide.md":      "nothing to do here\n",
+		"src/app/main.go":    "package main\n// TODO one\n// TODO two\n",
+		"src/app/util.go":    "package main\n",
+		"src/lib/big.txt":    strings.Repeat("TODO\n", 300),
+		"src/lib/image.bin":  "TODO\x00\x01\x02",
+		"vendor/dep/dep.go":  "// TODO vendored\n",
+		"empty/placeholder/": "",
+	})
+	opts := options{
+		printFiles:  true,
+		format:      formatText,
+		grep:        regexp.MustCompile(`TODO`),
+		grepMaxSize: 1024,
+		exclude:     []string{"vendor"},
+		workers:     3,
+	}
+	expected := `├───README.md (23b) [1 match]
+└───src
+	└───app
+		└───main.go (37b) [2 matches]
+`
+	if result := treeString(t, root, opts); result != expected {
+		t.Errorf("results not match\nGot:\n%v\nExpected:\n%v", result, expected)
+	}
+
+	opts.printFiles, opts.grepMaxSize = false, 0
+	expected = `└───src
+	├───app
+	└───lib
+`
+	if result := treeString(t, root, opts); result != expected {
+		t.Errorf("results not match\nGot:\n%v\nExpected:\n%v", result, expected)
+	}
+}
+
+// fails to open the chosen files
+type unopenableFS struct {
+	fstest.MapFS
+	locked map[string]bool
+}
+
+func (f unopenableFS) Open(name string) (fs.File, error) {
+	if f.locked[name] {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrPermission}
+	}
+	return f.MapFS.Open(name)
+}
+
+func TestGrepKeepGoing(t *testing.T) {
+	fsys := unopenableFS{
+		MapFS: fstest.MapFS{
+			"a/hit.txt":    {Data: []byte("needle")},
+			"a/miss.txt":   {Data: []byte("hay")},
+			"b/locked.txt": {Data: []byte("needle")},
+		},
+		locked: map[string]bool{"b/locked.txt": true},
+	}
+	opts := options{printFiles: true, format: formatText, grep: regexp.MustCompile("needle")}
+	if err := dirTreeFS(new(bytes.Buffer), fsys, opts); err == nil {
+		t.Errorf("expected an error for the unreadable file")
+	}
+
+	opts.keepGoing = true
+	out := new(bytes.Buffer)
+	err := dirTreeFS(out, fsys, opts)
+	errs, ok := err.(walkErrors)
+	if !ok || len(errs) != 1 || errs[0].path != "b/locked.txt" {
+		t.Errorf("unexpected error: %v", err)
+	}
+	expected := `├───a
+│	└───hit.txt (6b) [1 match]
+└───b
+	└───locked.txt (6b) [permission denied]
+`
+	if result := out.String(); result != expected {
+		t.Errorf("results not match\nGot:\n%v\nExpected:\n%v", result, expected)
+	}
+}
+
+func TestParseSize(t *testing.T) {
+	cases := map[string]int64{"512": 512, "64K": 64 << 10, "10m": 10 << 20, "1G": 1 << 30}
+	for s, expected := range cases {
+		if size, err := parseSize(s); err != nil || size != expected {
+			t.Errorf("%q: got %d, %v, expected %d", s, size, err, expected)
+		}
+	}
+	for _, s := range []string{"", "K", "0", "-1", "1T", "1.5M", "9999999999999G"} {
+		if _, err := parseSize(s); err == nil {
+			t.Errorf("%q: expected an error", s)
+		}
+	}
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"html/template"
+	"io"
+	"strings"
+)
+
+// one entry of the HTML page, and of the serve API
+type htmlEntry struct {
+	Name     string       `json:"name"`
+	Path     string       `json:"path"` // slash-separated, relative to the root
+	Type     string       `json:"type"` // one of the type* constants
+	Bytes    int64        `json:"bytes"`
+	Size     string       `json:"size,omitempty"` // as in the text tree: "19b", "68.7KiB", ...
+	Target   string       `json:"target,omitempty"`
+	Notes    []string     `json:"notes,omitempty"`
+	Lazy     bool         `json:"lazy,omitempty"` // serve: a directory listed on demand
+	Children []*htmlEntry `json:"-"`
+}
+
+func (e *htmlEntry) Dir() bool {
+	return e.Type == typeDir
+}
+
+type htmlPage struct {
+	Title string
+	Roots []htmlRoot
+}
+
+type htmlRoot struct {
+	Name    string // shown once there are several roots
+	Entries []*htmlEntry
+}
+
+func newHTMLEntry(entry *dirFile, rel string, opts options) *htmlEntry {
+	return &htmlEntry{
+		Name:   entry.name,
+		Path:   rel,
+		Type:   entryType(entry),
+		Bytes:  entry.size,
+		Size:   strings.TrimSuffix(strings.TrimPrefix(sizeLabel(entry, opts), " ("), ")"),
+		Target: entry.linkTarget,
+		Notes:  entry.notes,
+	}
+}
+
+// the entries below dir, honoring the options the same way printTreeFile does
+func htmlEntries(dir *dirFile, rel string, opts options, depth int) []*htmlEntry {
+	files := dir.subDirFiles // alias
+	sortFiles(files, opts)
+	var entries []*htmlEntry
+	for _, entry := range files {
+		if !entry.isDir && !opts.printFiles {
+			continue
+		}
+		node := newHTMLEntry(entry, joinRel(rel, entry.name), opts)
+		if node.Dir() && (opts.maxDepth == 0 || depth < opts.maxDepth) {
+			node.Children = htmlEntries(entry, node.Path, opts, depth+1)
+		}
+		entries = append(entries, node)
+	}
+	return entries
+}
+
+// a self-contained page: collapsible directories and a filter box, no
+// external resources
+func writeHTML(out io.Writer, trees []*dirFile, opts options) error {
+	page := htmlPage{}
+	var names []string
+	for _, tree := range trees {
+		names = append(names, tree.name)
+		root := htmlRoot{Entries: htmlEntries(tree, "", opts, 1)}
+		if len(trees) > 1 {
+			root.Name = tree.name
+		}
+		page.Roots = append(page.Roots, root)
+	}
+	page.Title = strings.Join(names, ", ")
+	return htmlTemplate.Execute(out, page)
+}
+
+var htmlTemplate = template.Must(template.New("page").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+<style>
+body { font: 14px/1.5 monospace; margin: 1em 2em; }
+#search { font: inherit; width: 30em; margin-bottom: 1em; }
+ul { list-style: none; margin: 0; padding-left: 1.5em; }
+.tree > ul { padding-left: 0; }
+summary { cursor: pointer; }
+.directory { color: #1f4fbf; font-weight: bold; }
+.link { color: #0b8a8a; }
+.size, .target { color: #666; }
+.note { color: #b02020; }
+[hidden] { display: none; }
+</style>
+</head>
+<body>
+<input id="search" type="search" placeholder="filter by name" autofocus>
+{{range .Roots}}{{with .Name}}<h2>{{.}}</h2>
+{{end}}<div class="tree">{{template "entries" .Entries}}</div>
+{{end}}<script>
+"use strict";
+
+// a list like the server-side template renders it
+function renderList(entries) {
+	const ul = document.createElement("ul");
+	for (const entry of entries) {
+		const li = document.createElement("li");
+		li.dataset.name = entry.name;
+		let label = li;
+		if (entry.type === "directory") {
+			const details = document.createElement("details");
+			label = document.createElement("summary");
+			details.append(label);
+			if (entry.lazy) {
+				details.dataset.path = entry.path;
+			}
+			li.append(details);
+		}
+		const name = document.createElement("span");
+		name.className = "name " + entry.type;
+		name.textContent = entry.name;
+		label.append(name);
+		const info = (cls, text) => {
+			const span = document.createElement("span");
+			span.className = cls;
+			span.textContent = text;
+			label.append(" ", span);
+		};
+		if (entry.target) info("target", "-> " + entry.target);
+		if (entry.size) info("size", "(" + entry.size + ")");
+		for (const note of entry.notes || []) info("note", "[" + note + "]");
+		ul.append(li);
+	}
+	return ul;
+}
+
+// serve mode: directories with a data-path are listed when first opened
+document.addEventListener("toggle", async (event) => {
+	const details = event.target;
+	if (!details.open || !details.dataset.path || details.dataset.loaded) {
+		return;
+	}
+	details.dataset.loaded = "yes";
+	const resp = await fetch("api/tree?path=" + encodeURIComponent(details.dataset.path));
+	if (!resp.ok) {
+		const note = document.createElement("span");
+		note.className = "note";
+		note.textContent = " [" + (await resp.text()).trim() + "]";
+		details.firstElementChild.append(note);
+		return;
+	}
+	const dir = await resp.json();
+	details.append(renderList(dir.entries || []));
+	filter();
+}, true);
+
+// show the entries whose name contains the query, and the directories above them
+function filterList(ul, query) {
+	let any = false;
+	for (const li of ul.children) {
+		const details = li.querySelector(":scope > details");
+		const sub = details && details.querySelector(":scope > ul");
+		const inner = sub ? filterList(sub, query) : false;
+		const show = !query || li.dataset.name.toLowerCase().includes(query) || inner;
+		li.hidden = !show;
+		if (query && inner) {
+			details.open = true;
+		}
+		any = any || show;
+	}
+	return any;
+}
+
+const search = document.getElementById("search");
+function filter() {
+	const query = search.value.trim().toLowerCase();
+	for (const tree of document.querySelectorAll(".tree > ul")) {
+		filterList(tree, query);
+	}
+}
+search.addEventListener("input", filter);
+</script>
+</body>
+</html>
+{{- define "entries"}}<ul>{{range .}}
+<li data-name="{{.Name}}">{{if .Dir}}<details{{if .Lazy}} data-path="{{.Path}}"{{end}}><summary>{{template "label" .}}</summary>{{with .Children}}{{template "entries" .}}{{end}}</details>{{else}}{{template "label" .}}{{end}}</li>{{end}}
+</ul>{{end}}
+{{- define "label"}}<span class="name {{.Type}}">{{.Name}}</span>{{with .Target}} <span class="target">-&gt; {{.}}</span>{{end}}{{with .Size}} <span class="size">({{.}})</span>{{end}}{{range .Notes}} <span class="note">[{{.}}]</span>{{end}}{{end}}
+`))
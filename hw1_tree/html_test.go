@@ -0,0 +1,47 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestTreeHTML(t *testing.T) {
+	out := new(bytes.Buffer)
+	opts := options{printFiles: true, format: formatHTML, human: true, maxDepth: 2}
+	if err := dirTreeWith(out, "testdata/zline", opts); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	result := out.String()
+	start, end := strings.Index(result, `<div class="tree">`), strings.Index(result, "</div>")
+	if start < 0 || end < start || !strings.HasPrefix(result, "<!DOCTYPE html>") {
+		t.Fatalf("not a tree page:\n%v", result)
+	}
+	expected := `<div class="tree"><ul>
+<li data-name="empty.txt"><span class="name file">empty.txt</span> <span class="size">(empty)</span></li>
+<li data-name="lorem"><details><summary><span class="name directory">lorem</span></summary><ul>
+<li data-name="dolor.txt"><span class="name file">dolor.txt</span> <span class="size">(empty)</span></li>
+<li data-name="gopher.png"><span class="name file">gopher.png</span> <span class="size">(68.7KiB)</span></li>
+<li data-name="ipsum"><details><summary><span class="name directory">ipsum</span></summary></details></li>
+</ul></details></li>
+</ul>`
+	if section := result[start:end]; section != expected {
+		t.Errorf("results not match\nGot:\n%v\nExpected:\n%v", section, expected)
+	}
+	for _, part := range []string{"<title>zline</title>", `<input id="search"`, "function filterList"} {
+		if !strings.Contains(result, part) {
+			t.Errorf("page lacks %q", part)
+		}
+	}
+	if strings.Contains(result, "http://") || strings.Contains(result, "https://") {
+		t.Errorf("page is not self-contained")
+	}
+}
+
+func TestTreeHTMLEscaping(t *testing.T) {
+	root := makeTree(t, map[string]string{`<b>"x"&y.txt`: "x"})
+	result := treeString(t, root, options{printFiles: true, format: formatHTML})
+	if !strings.Contains(result, `data-name="&lt;b&gt;&#34;x&#34;&amp;y.txt"`) || strings.Contains(result, "<b>") {
+		t.Errorf("name not escaped:\n%v", result)
+	}
+}
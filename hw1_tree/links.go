@@ -0,0 +1,173 @@
+package main
+
+import (
+	"io/fs"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// symlink handling modes
+const (
+	linksFollow = "follow" // follow, but never back into an ancestor (default)
+	linksShow   = "show"   // list as "name -> target", never follow
+	linksInside = "inside" // follow only links resolving inside the root
+)
+
+// nested followed links are cut off here when there is nothing to compare
+const maxLinkDepth = 40
+
+// notes on links pointing nowhere, and on links an fs.FS can not read
+const (
+	noteBrokenLink     = "broken link"
+	noteUnreadableLink = "link not readable"
+)
+
+// describe one directory entry; links are resolved according to the mode,
+// broken ones are reported on the entry instead of failing the walk
+func (w *walker) stat(entry fs.DirEntry, rel string) (*dirFile, fs.FileInfo, error) {
+	info, err := entry.Info()	// lstat
+	if err != nil {
+		return nil, nil, err
+	}
+	if info.Mode()&fs.ModeSymlink == 0 {
+		return newDirFile(info), info, nil
+	}
+
+	name := w.fsName(rel)
+	if _, ok := w.src.fsys.(fs.ReadLinkFS); !ok {
+		// listed as it is, not followed
+		node := &dirFile{name: info.Name(), modTime: info.ModTime(), info: info, linkOnly: true}
+		node.notes = append(node.notes, noteUnreadableLink)
+		return node, info, nil
+	}
+	target, err := fs.ReadLink(w.src.fsys, name)
+	if err != nil {
+		return nil, nil, err
+	}
+	targetInfo, err := fs.Stat(w.src.fsys, name)
+	if err != nil {
+		// dangling (or self-referencing) link
+		node := &dirFile{name: info.Name(), modTime: info.ModTime(), info: info, linkTarget: target, linkOnly: true}
+		node.notes = append(node.notes, noteBrokenLink)
+		return node, info, nil
+	}
+
+	node := newDirFile(targetInfo)
+	node.name = info.Name() // not the name of the target
+	node.linkTarget = target
+	switch w.opts.links {
+	case linksShow:
+		node.linkOnly = true
+		node.info = info // the link, not its target
+	case linksInside:
+		if !w.insideRoot(name, target) {
+			node.linkOnly = true
+			node.info = info
+			node.notes = append(node.notes, "outside root, not followed")
+		}
+	}
+	return node, targetInfo, nil
+}
+
+func (w *walker) insideRoot(name, target string) bool {
+	if w.realRoot == "" {
+		// no OS paths to resolve: resolve inside the fs.FS
+		real, ok := realName(w.src.fsys, name)
+		root := w.src.root
+		return ok && (root == "." || real == root || strings.HasPrefix(real, root+"/"))
+	}
+	real, err := filepath.EvalSymlinks(filepath.Join(w.src.osDir, filepath.FromSlash(name)))
+	if err != nil {
+		return false
+	}
+	rel, err := filepath.Rel(w.realRoot, real)
+	if err != nil {
+		return false
+	}
+	return rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// name with every link on the way resolved; false if that leads out of fsys
+func realName(fsys fs.FS, name string) (string, bool) {
+	parts := splitName(name)
+	cur, hops := ".", 0
+	for i := 0; i < len(parts); i++ {
+		next := path.Join(cur, parts[i])
+		info, err := fs.Lstat(fsys, next)
+		if err != nil {
+			return "", false
+		}
+		if info.Mode()&fs.ModeSymlink != 0 {
+			if hops++; hops > maxLinkDepth {
+				return "", false
+			}
+			target, err := fs.ReadLink(fsys, next)
+			if err != nil || path.IsAbs(target) {
+				return "", false
+			}
+			resolved := path.Join(cur, target)
+			if !fs.ValidPath(resolved) {
+				return "", false
+			}
+			// start over with the link replaced by its target
+			parts = append(splitName(resolved), parts[i+1:]...)
+			cur, i = ".", -1
+			continue
+		}
+		cur = next
+	}
+	return cur, true
+}
+
+// "a/b" -> ["a", "b"], "." -> none
+func splitName(name string) []string {
+	if name == "." {
+		return nil
+	}
+	return strings.Split(name, "/")
+}
+
+// directories on the way down, identified by device + inode or,
+// where the fs.FS has no inodes, by their name with all links resolved
+type visitChain struct {
+	id     fileID
+	hasID  bool
+	real   string
+	parent *visitChain
+}
+
+func visit(parent *visitChain, info fs.FileInfo, real string) *visitChain {
+	id, ok := identify(info)
+	return &visitChain{id: id, hasID: ok, real: real, parent: parent}
+}
+
+func (chain *visitChain) contains(info fs.FileInfo, real string) bool {
+	id, ok := identify(info)
+	for ; chain != nil; chain = chain.parent {
+		if ok && chain.hasID && chain.id == id {
+			return true
+		}
+		if !ok && real != "" && chain.real == real {
+			return true
+		}
+	}
+	return false
+}
+
+// "name -> target" for links
+func nameLabel(entry *dirFile) string {
+	if entry.linkTarget == "" {
+		return entry.name
+	}
+	return entry.name + " -> " + entry.linkTarget
+}
+
+// " [note]" per note; notice the leading space
+func noteLabel(entry *dirFile) string {
+	var label string
+	for _, note := range entry.notes {
+		label += " [" + note + "]"
+	}
+	return label
+}
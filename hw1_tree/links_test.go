@@ -0,0 +1,73 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// root/
+//   alias -> data            (inside the root)
+//   broken -> missing
+//   data/file.txt
+//   data/loop -> ..          (cycle)
+//   outside -> <other dir>   (outside the root)
+func makeLinkTree(t *testing.T) (root, other string) {
+	other = makeTree(t, map[string]string{"other.txt": "other"})
+	root = makeTree(t, map[string]string{"data/file.txt": "file"})
+	links := map[string]string{
+		"data/loop": "..",
+		"alias":     "data",
+		"outside":   other,
+		"broken":    "missing",
+	}
+	for name, target := range links {
+		if err := os.Symlink(target, filepath.Join(root, filepath.FromSlash(name))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return root, other
+}
+
+func TestLinks(t *testing.T) {
+	root, other := makeLinkTree(t)
+	cases := []struct {
+		links    string
+		expected string
+	}{
+		{linksShow, `├───alias -> data
+├───broken -> missing [broken link]
+├───data
+│	├───file.txt (4b)
+│	└───loop -> ..
+└───outside -> ` + other + `
+`},
+		{linksFollow, `├───alias -> data
+│	├───file.txt (4b)
+│	└───loop -> .. [recursive, not followed]
+├───broken -> missing [broken link]
+├───data
+│	├───file.txt (4b)
+│	└───loop -> .. [recursive, not followed]
+└───outside -> ` + other + `
+	└───other.txt (5b)
+`},
+		{linksInside, `├───alias -> data
+│	├───file.txt (4b)
+│	└───loop -> .. [recursive, not followed]
+├───broken -> missing [broken link]
+├───data
+│	├───file.txt (4b)
+│	└───loop -> .. [recursive, not followed]
+└───outside -> ` + other + ` [outside root, not followed]
+`},
+	}
+	for _, c := range cases {
+		for _, workers := range []int{1, 4} {
+			opts := options{printFiles: true, format: formatText, links: c.links, workers: workers}
+			if result := treeString(t, root, opts); result != c.expected {
+				t.Errorf("%s: results not match\nGot:\n%v\nExpected:\n%v", c.links, result, c.expected)
+			}
+		}
+	}
+}
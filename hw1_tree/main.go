@@ -3,36 +3,142 @@ package main
 import (
 	"fmt"
 	"io"
+	"io/fs"
 	"os"
+	"path"
 	"path/filepath"
+	"regexp"
 	"sort" // sorter
+	"sync"
+	"time"
 )
 
 func main() {
-	out := os.Stdout
-	if !(len(os.Args) == 2 || len(os.Args) == 3) {
-		panic("usage go run main.go . [-f]")
-	}
-	path := os.Args[1]
-	printFiles := len(os.Args) == 3 && os.Args[2] == "-f"
-	err := dirTree(out, path, printFiles)
-	if err != nil {
-		panic(err.Error())
-	}
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+// output formats
+const (
+	formatText = "text"	// box-drawing tree (default)
+	formatJSON = "json"
+	formatXML = "xml"
+	formatHTML = "html"	// self-contained page
+	formatSnapshot = "snapshot"	// binary, see snapshot.go
+)
+
+type options struct {
+	printFiles bool	// list files, not only directories
+	format string	// one of the format* constants
+	include []string	// -P: only list files matching one of these globs
+	exclude []string	// -I: skip files and directories matching these globs
+	gitignore bool	// honor .gitignore files found during the walk
+	du bool	// show recursive size and file count of directories
+	human bool	// sizes in KiB/MiB/GiB instead of bytes
+	maxDepth int	// -L: levels to list, 0 = unlimited
+	workers int	// -j: directories listed concurrently, <= 1 = sequential
+	links string	// one of the links* modes
+	keepGoing bool	// -k: mark unreadable entries instead of failing
+	sortBy string	// one of the sortBy* keys, "" = name
+	reverse bool	// -r: reverse the sort order
+	dirsFirst bool	// list directories before files
+	columns columns	// metadata shown in front of the names
+	dups bool	// report files with identical content
+	markDups bool	// and mark them in the tree
+	watch bool	// keep running, re-print on changes
+	stats bool	// print counts, extensions and the largest files after the tree
+	statsTop int	// rows per stats table, 0 = defaultTop
+	grep *regexp.Regexp	// keep only files whose content matches
+	grepMaxSize int64	// larger files are not searched, 0 = defaultGrepMaxSize
+	hashes bool	// store content hashes in snapshots
+	stream bool	// print while walking, one directory in memory per level
+	color string	// one of the color* modes, "" = auto
+	colors *lsColors	// resolved from color: nil = plain text
 }
 
 func dirTree(in io.Writer, path string, printFiles bool) error {
-	dir, err := filepath.Abs(path) // get the absolute path
+	return dirTreeWith(in, path, options{printFiles: printFiles, format: formatText, links: linksFollow})
+}
+
+func dirTreeWith(in io.Writer, path string, opts options) error {
+	src, err := openSource(path)	// directory, file or archive
 	if err != nil {
 		return err
 	}
-	tree, err := walkFiles(dir)	// construct the file tree
-	if err != nil {
+	defer src.Close()
+	return renderTree(in, src, opts)
+}
+
+// render any fs.FS (embedded, in-memory, ...) starting at its root
+func dirTreeFS(in io.Writer, fsys fs.FS, opts options) error {
+	return renderTree(in, &source{fsys: fsys, root: ".", name: ".", label: "."}, opts)
+}
+
+func renderTree(in io.Writer, src *source, opts options) error {
+	if opts.stream && src.tree == nil {
+		return streamTree(in, src, opts)	// no tree in memory
+	}
+	tree, dups, err := loadRoot(src, opts)
+	if tree == nil {
 		return err
 	}
-	printTree(in, tree, printFiles)
+	// err is nil or the walkErrors of a keep-going walk: the tree goes out anyway
+	if err := writeTree(in, tree, opts); err != nil {
+		return err
+	}
+	if opts.dups && opts.format == formatText {
+		writeDuplicates(in, dups, opts.human)
+	}
+	if opts.stats && opts.format == formatText {
+		writeStats(in, collectStats(tree, opts), opts)
+	}
+	return err
+}
 
-	return nil // no errors
+// walk one root and do everything the output needs before it is written
+func loadRoot(src *source, opts options) (*dirFile, []dupSet, error) {
+	tree, err := walkSource(src, opts)	// construct the file tree
+	if tree == nil {
+		return nil, nil, err
+	}
+	if opts.grep != nil {
+		if err = mergeErrors(err, grepTree(src, tree, opts)); !partial(err) {
+			return nil, nil, err
+		}
+	}
+	if opts.hashes && src.tree == nil {
+		if err = mergeErrors(err, hashTree(src, tree, opts)); !partial(err) {	// after --grep: only what is left
+			return nil, nil, err
+		}
+	}
+	aggregate(tree)	// directory totals (du)
+
+	var dups []dupSet
+	if opts.dups {
+		var dupErr error
+		if dups, dupErr = findDuplicates(src, tree, opts); dupErr != nil {
+			return nil, nil, dupErr
+		}
+		if opts.markDups {
+			markDuplicates(dups)
+		}
+	}
+	return tree, dups, err
+}
+
+// in the requested format
+func writeTree(out io.Writer, tree *dirFile, opts options) error {
+	switch opts.format {
+	case formatJSON:
+		return writeJSON(out, tree, opts)
+	case formatXML:
+		return writeXML(out, tree, opts)
+	case formatHTML:
+		return writeHTML(out, []*dirFile{tree}, opts)
+	case formatSnapshot:
+		return writeSnapshot(out, tree, opts)
+	}
+	printTree(out, tree, opts)
+	return nil
 }
 
 // ---
@@ -41,61 +147,224 @@ type dirFile struct {
 	name string	// file / directory name
 	size int64	// file size
 	isDir bool	// is the file a directory
+	modTime time.Time	// last modification
+	info os.FileInfo	// everything else (nil if it could not be read)
+	linkTarget string	// symlinks only
+	linkOnly bool	// symlink listed, but not followed
+	notes []string	// shown in brackets after the entry
+	hash []byte	// sha256 of the content (--hashes and snapshots only)
+	totalSize int64	// recursive size (files: == size)
+	fileCount int	// recursive number of files (files: 1)
 	// ---
 	subDirFiles []*dirFile	// recursion
 }
 
 // traverse file dir
-func walkFiles(path string) (*dirFile, error) {
-	f, err := os.Open(path)
+func walkFiles(path string, opts options) (*dirFile, error) {
+	src, err := openSource(path)
+	if err != nil {
+		return nil, err
+	}
+	defer src.Close()
+	return walkSource(src, opts)
+}
+
+func walkSource(src *source, opts options) (*dirFile, error) {
+	if src.tree != nil {
+		pruneSnapshot(src.tree, "", opts)	// saved, filtered like a live walk
+		return src.tree, nil
+	}
+	fileInfo, err := fs.Stat(src.fsys, src.root)	// info about the file (name, size)
 	if err != nil {
 		return nil, err
 	}
-	defer f.Close() // close the file descriptor (not sure if needed)
-	fileInfo, err := f.Stat()	// info about the file (name, size)
+	root := newDirFile(fileInfo)
+	root.name = src.name	// os.DirFS calls its root "."
+	if !root.isDir {
+		return root, nil
+	}
+
+	w, err := newWalker(src, opts)
 	if err != nil {
 		return nil, err
 	}
-	dirFile := &dirFile {
+	job := dirJob{node: root, real: src.root, ancestors: visit(nil, fileInfo, src.root)}
+	if opts.workers > 1 {
+		err = w.walkParallel(job, opts.workers)
+	} else {
+		err = w.walk(job)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(w.errs) > 0 {
+		// parallel walks fail in any order
+		sort.Slice(w.errs, func(i, j int) bool {
+			return w.errs[i].path < w.errs[j].path
+		})
+		return root, w.errs	// partial tree
+	}
+	return root, nil	// no errors
+}
+
+func newDirFile(fileInfo os.FileInfo) *dirFile {
+	return &dirFile {
 		name: fileInfo.Name(),
 		size: fileInfo.Size(),
-		isDir: fileInfo.IsDir(),	// trailing comma is required (do not remove)
+		isDir: fileInfo.IsDir(),
+		modTime: fileInfo.ModTime(),
+		info: fileInfo,	// trailing comma is required (do not remove)
 	}
+}
 
-	if fileInfo.IsDir() {
-		// get sub-file names -> paths
-		subFileNames, err := f.Readdirnames(-1)
-		if err != nil {
+func newWalker(src *source, opts options) (*walker, error) {
+	w := &walker{opts: opts, src: src}
+	if opts.links == linksInside && src.osDir != "" {
+		var err error
+		if w.realRoot, err = filepath.EvalSymlinks(src.osDir); err != nil {
 			return nil, err
 		}
-		// fmt.Println(subFileNames)
-		for _, subFileName := range subFileNames {
-			// construct the file path
-			filePath := filepath.Join(path, subFileName)
-			// recursive call
-			subFiles, err := walkFiles(filePath)
-			if err != nil {
+	}
+	return w, nil
+}
+
+// walk state shared by the whole traversal
+type walker struct {
+	opts options
+	src *source	// what is being walked
+	realRoot string	// root with all links resolved (links inside mode)
+	mu sync.Mutex	// guards errs (parallel walk)
+	errs walkErrors	// keep-going mode only
+}
+
+// a directory that still has to be listed
+type dirJob struct {
+	node *dirFile	// gets the directory entries
+	rel string	// slash-separated path relative to the root ("" for the root itself)
+	real string	// fs name with all links resolved ("" if unknown)
+	ignores ignoreRules	// .gitignore rules in effect for the entries
+	ancestors *visitChain	// the directory itself and everything above it
+	linkDepth int	// followed links on the way down
+}
+
+// sequential, depth-first
+func (w *walker) walk(job dirJob) error {
+	subDirs, err := w.readDir(job)
+	if err != nil {
+		return err
+	}
+	for _, subDir := range subDirs {
+		// recursive call
+		if err := w.walk(subDir); err != nil {
+			return err
+		}
+	}
+	return nil	// no errors
+}
+
+// list one directory into job.node; returns the sub-directories to descend into
+func (w *walker) readDir(job dirJob) ([]dirJob, error) {
+	// get sub-file entries (names + lstat info)
+	entries, err := fs.ReadDir(w.src.fsys, w.fsName(job.rel))
+	if err != nil {
+		return nil, w.fail(job.node, job.rel, err)
+	}
+	ignores := job.ignores
+	if w.opts.gitignore {
+		ignores, err = ignores.load(w.src.fsys, w.fsName(job.rel), job.rel)
+		if err != nil {
+			// keep going with the inherited rules
+			if err := w.fail(job.node, job.rel, err); err != nil {
 				return nil, err
 			}
-			dirFile.subDirFiles = append(dirFile.subDirFiles, subFiles)
+			ignores = job.ignores
 		}
 	}
 
-	return dirFile, nil	// no errors
+	var subDirs []dirJob
+	for _, entry := range entries {
+		subFile, subDir, err := w.entry(job, entry, ignores)
+		if err != nil {
+			return nil, err
+		}
+		if subFile == nil {
+			continue	// pruned
+		}
+		job.node.subDirFiles = append(job.node.subDirFiles, subFile)
+		if subDir != nil {
+			subDirs = append(subDirs, *subDir)
+		}
+	}
+
+	return subDirs, nil	// no errors
+}
+
+// describe one entry of the directory job (nil if pruned) and,
+// for directories to descend into, the job listing it
+func (w *walker) entry(job dirJob, entry fs.DirEntry, ignores ignoreRules) (*dirFile, *dirJob, error) {
+	subRel := joinRel(job.rel, entry.Name())
+	subFile, subInfo, err := w.stat(entry, subRel)	// files are never opened
+	if err != nil {
+		subFile = &dirFile{name: entry.Name()}
+		if err := w.fail(subFile, subRel, err); err != nil {
+			return nil, nil, err
+		}
+		return subFile, nil, nil
+	}
+	// pruned entries (and whole directories) are never opened
+	if w.opts.pruned(subRel, subFile.isDir, ignores) {
+		return nil, nil, nil
+	}
+	linkDepth := job.linkDepth
+	subReal := ""
+	if job.real != "" {
+		subReal = path.Join(job.real, entry.Name())
+	}
+	if subFile.isDir && subFile.linkTarget != "" && !subFile.linkOnly {
+		linkDepth++
+		subReal, _ = realName(w.src.fsys, w.fsName(subRel))
+		switch {
+		case job.ancestors.contains(subInfo, subReal):
+			subFile.linkOnly = true	// would loop forever
+			subFile.notes = append(subFile.notes, "recursive, not followed")
+		case linkDepth > maxLinkDepth:
+			subFile.linkOnly = true	// no inodes to tell
+			subFile.notes = append(subFile.notes, "too many levels of links, not followed")
+		}
+	}
+	if !subFile.isDir || subFile.linkOnly {
+		return subFile, nil, nil
+	}
+	return subFile, &dirJob{
+		node: subFile,
+		rel: subRel,
+		real: subReal,
+		ignores: ignores,
+		ancestors: visit(job.ancestors, subInfo, subReal),
+		linkDepth: linkDepth,
+	}, nil
+}
+
+// name inside the walked fs.FS
+func (w *walker) fsName(rel string) string {
+	return path.Join(w.src.root, rel)
 }
 
 // facade
-func printTree(out io.Writer, root *dirFile, printFiles bool) {
-	printTreeFile(out, root, printFiles, "")
+func printTree(out io.Writer, root *dirFile, opts options) {
+	printTreeFile(out, root, opts, "", 1)
+}
+
+// everything after the prefix: columns, name, size and notes
+func entryLabel(entry *dirFile, opts options) string {
+	return opts.columns.label(entry) + opts.colors.label(entry) + sizeLabel(entry, opts) + noteLabel(entry)
 }
 
 // recursive; should be error-free
-func printTreeFile(out io.Writer, root *dirFile, printFiles bool, dirPrefix string) {
+func printTreeFile(out io.Writer, root *dirFile, opts options, dirPrefix string, depth int) {
+	printFiles := opts.printFiles	// alias
 	files := root.subDirFiles	// alias
-	// sort lexicographically (i.e alphabetically)
-	sort.Slice(files, func(i, j int) bool {
-		return files[i].name < files[j].name
-	})
+	sortFiles(files, opts)
 
 	var lastIdx int
 	for idx, entry := range files {
@@ -123,22 +392,13 @@ func printTreeFile(out io.Writer, root *dirFile, printFiles bool, dirPrefix stri
 			nextLevelPrefix = dirPrefix + "│\t"
 		}
 
-		// print the entry information - name and size (only for files)
-		var size string // empty string
-		if !entry.isDir {	// is file?
-			if entry.size > 0 {
-				size = fmt.Sprintf(" (%db)", entry.size)	// notice space
-			} else {
-				size = " (empty)" // notice space
-			}
-		}
-		// to remove the extra space in-between
-		line := prefix + entry.name + size
+		// print the entry information - name and size (only for files, unless du)
+		line := prefix + entryLabel(entry, opts)
 		fmt.Fprintln(out, line)	// Println is NOT to be used
 
 		// recursive call
-		if entry.isDir {
-			printTreeFile(out, entry, printFiles, nextLevelPrefix)
+		if entry.isDir && (opts.maxDepth == 0 || depth < opts.maxDepth) {
+			printTreeFile(out, entry, opts, nextLevelPrefix, depth+1)
 		}
 	}
 }
@@ -0,0 +1,71 @@
+package main
+
+import "sync"
+
+// directories waiting to be listed by the worker pool
+type dirQueue struct {
+	mu      sync.Mutex
+	cond    *sync.Cond
+	jobs    []dirJob
+	pending int   // queued + being listed; the walk is over at 0
+	err     error // first failure, stops the walk
+}
+
+// list directories with a bounded pool of workers; builds the same tree as walk
+// (entry order may differ, printTreeFile sorts anyway)
+func (w *walker) walkParallel(root dirJob, workers int) error {
+	q := &dirQueue{jobs: []dirJob{root}, pending: 1}
+	q.cond = sync.NewCond(&q.mu)
+
+	wg := &sync.WaitGroup{}
+	wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go func() {
+			defer wg.Done() // -1
+			for {
+				job, ok := q.next()
+				if !ok {
+					return
+				}
+				subDirs, err := w.readDir(job)
+				q.done(subDirs, err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	return q.err
+}
+
+// block until there is a job or the walk is over
+func (q *dirQueue) next() (dirJob, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for len(q.jobs) == 0 && q.pending > 0 {
+		q.cond.Wait()
+	}
+	if q.pending == 0 {
+		return dirJob{}, false
+	}
+	// LIFO: depth-first keeps the queue short
+	job := q.jobs[len(q.jobs)-1]
+	q.jobs = q.jobs[:len(q.jobs)-1]
+	return job, true
+}
+
+// report a listed directory and queue its sub-directories
+func (q *dirQueue) done(subDirs []dirJob, err error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if err != nil && q.err == nil {
+		q.err = err
+		q.pending -= len(q.jobs) // drop everything not started yet
+		q.jobs = nil
+	}
+	if q.err == nil {
+		q.jobs = append(q.jobs, subDirs...)
+		q.pending += len(subDirs)
+	}
+	q.pending--
+	q.cond.Broadcast()
+}
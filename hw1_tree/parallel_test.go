@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// generate a balanced tree: fanout sub-directories per level, files in every directory
+func makeFixture(tb testing.TB, depth, fanout, files int) string {
+	root := tb.TempDir()
+	var fill func(dir string, level int)
+	fill = func(dir string, level int) {
+		for i := 0; i < files; i++ {
+			name := filepath.Join(dir, fmt.Sprintf("file%d.txt", i))
+			if err := os.WriteFile(name, make([]byte, i), 0644); err != nil {
+				tb.Fatal(err)
+			}
+		}
+		if level == depth {
+			return
+		}
+		for i := 0; i < fanout; i++ {
+			sub := filepath.Join(dir, fmt.Sprintf("dir%d", i))
+			if err := os.Mkdir(sub, 0755); err != nil {
+				tb.Fatal(err)
+			}
+			fill(sub, level+1)
+		}
+	}
+	fill(root, 0)
+	return root
+}
+
+func TestParallelMatchesSequential(t *testing.T) {
+	fixture := makeFixture(t, 3, 4, 3)
+	for _, path := range []string{"testdata", fixture} {
+		for _, workers := range []int{2, 8} {
+			opts := options{printFiles: true, format: formatText, du: true}
+			expected := treeString(t, path, opts)
+			opts.workers = workers
+			if result := treeString(t, path, opts); result != expected {
+				t.Errorf("%s with %d workers: results not match\nGot:\n%v\nExpected:\n%v", path, workers, result, expected)
+			}
+		}
+	}
+}
+
+func TestParallelError(t *testing.T) {
+	if os.Geteuid() == 0 {
+		t.Skip("root can open any directory")
+	}
+	root := makeFixture(t, 2, 3, 1)
+	locked := filepath.Join(root, "dir1", "dir2")
+	if err := os.Chmod(locked, 0); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chmod(locked, 0755)
+	if _, err := walkFiles(root, options{workers: 4}); err == nil {
+		t.Errorf("expected an error for the unreadable directory")
+	}
+}
+
+func benchmarkWalk(b *testing.B, workers int) {
+	root := makeFixture(b, 4, 6, 8) // 1555 directories, 12440 files
+	opts := options{workers: workers}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := walkFiles(root, opts); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkWalkSequential(b *testing.B) { benchmarkWalk(b, 1) }
+func BenchmarkWalkParallel4(b *testing.B)  { benchmarkWalk(b, 4) }
+func BenchmarkWalkParallel16(b *testing.B) { benchmarkWalk(b, 16) }
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// a listing shared over HTTP: the page shows the first level, every
+// directory below is fetched from /api/tree?path=rel when it is opened.
+// Only names and sizes are served, never file contents.
+type treeServer struct {
+	src  *source
+	opts options
+}
+
+// one directory, as /api/tree returns it
+type apiDir struct {
+	Path    string       `json:"path"`
+	Notes   []string     `json:"notes,omitempty"` // the directory could not be (fully) read
+	Entries []*htmlEntry `json:"entries"`
+}
+
+func newTreeServer(src *source, opts options) (*treeServer, error) {
+	if err := src.needFiles(); err != nil {
+		return nil, err // every request reads afresh
+	}
+	info, err := fs.Stat(src.fsys, src.root)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("%s: not a directory", src.label)
+	}
+	opts.keepGoing = true // errors are shown inline
+	return &treeServer{src: src, opts: opts}, nil
+}
+
+func (s *treeServer) handler() http.Handler {
+	// plain paths: method patterns need a go.mod asking for go1.22
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", s.page)
+	mux.HandleFunc("/api/tree", s.tree)
+	return mux
+}
+
+func (s *treeServer) page(rw http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(rw, r)
+		return
+	}
+	if !allowGet(rw, r) {
+		return
+	}
+	dir, status, err := s.list("")
+	if err != nil {
+		http.Error(rw, err.Error(), status)
+		return
+	}
+	page := htmlPage{Title: s.src.name, Roots: []htmlRoot{{Entries: dir.Entries}}}
+	rw.Header().Set("Content-Type", "text/html; charset=utf-8")
+	htmlTemplate.Execute(rw, page)
+}
+
+func (s *treeServer) tree(rw http.ResponseWriter, r *http.Request) {
+	if !allowGet(rw, r) {
+		return
+	}
+	dir, status, err := s.list(r.URL.Query().Get("path"))
+	if err != nil {
+		http.Error(rw, err.Error(), status)
+		return
+	}
+	rw.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(rw).Encode(dir)
+}
+
+// a read-only listing
+func allowGet(rw http.ResponseWriter, r *http.Request) bool {
+	if r.Method == http.MethodGet || r.Method == http.MethodHead {
+		return true
+	}
+	rw.Header().Set("Allow", "GET, HEAD")
+	http.Error(rw, "method not allowed", http.StatusMethodNotAllowed)
+	return false
+}
+
+// read the directory at rel afresh, with an HTTP status for the failures
+func (s *treeServer) list(rel string) (*apiDir, int, error) {
+	if rel != "" && (!fs.ValidPath(rel) || rel == ".") {
+		return nil, http.StatusBadRequest, errors.New("invalid path")
+	}
+	w, err := newWalker(s.src, s.opts) // per request: nothing accumulates
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+	job, err := w.resolve(rel)
+	if err != nil {
+		return nil, http.StatusNotFound, err
+	}
+	if _, err := w.readDir(job); err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+	aggregate(job.node) // file sizes for --sort size
+
+	depth := 1
+	if rel != "" {
+		depth += strings.Count(rel, "/") + 1
+	}
+	dir := &apiDir{Path: rel, Notes: job.node.notes, Entries: htmlEntries(job.node, rel, s.opts, depth)}
+	for _, entry := range dir.Entries {
+		entry.Lazy = entry.Dir() && (s.opts.maxDepth == 0 || depth < s.opts.maxDepth)
+	}
+	if dir.Entries == nil {
+		dir.Entries = []*htmlEntry{} // [] rather than null
+	}
+	return dir, http.StatusOK, nil
+}
+
+// the job listing the directory at rel, reached from the root one name at
+// a time so that filters, .gitignore rules and the links mode all apply
+func (w *walker) resolve(rel string) (dirJob, error) {
+	info, err := fs.Stat(w.src.fsys, w.src.root)
+	if err != nil {
+		return dirJob{}, err
+	}
+	job := dirJob{node: newDirFile(info), real: w.src.root, ancestors: visit(nil, info, w.src.root)}
+	if rel == "" {
+		return job, nil
+	}
+	for idx, name := range strings.Split(rel, "/") {
+		if w.opts.maxDepth > 0 && idx+1 >= w.opts.maxDepth {
+			return dirJob{}, errors.New("below the depth limit")
+		}
+		ignores := job.ignores
+		if w.opts.gitignore {
+			ignores, _ = ignores.load(w.src.fsys, w.fsName(job.rel), job.rel)
+		}
+		info, err := fs.Lstat(w.src.fsys, w.fsName(joinRel(job.rel, name)))
+		if err != nil {
+			return dirJob{}, errors.New("no such directory")
+		}
+		_, subDir, err := w.entry(job, fs.FileInfoToDirEntry(info), ignores)
+		if err != nil || subDir == nil {
+			return dirJob{}, errors.New("no such directory") // a file, pruned or a link not followed
+		}
+		job = *subDir
+	}
+	return job, nil
+}
+
+// serve until ctx is done
+func serveTree(ctx context.Context, stderr io.Writer, addr, path string, opts options) error {
+	src, err := openSource(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	s, err := newTreeServer(src, opts)
+	if err != nil {
+		return err
+	}
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(stderr, "serving %s on http://%s/\n", src.label, ln.Addr())
+
+	server := &http.Server{Handler: s.handler(), ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		<-ctx.Done()
+		shutdown, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		server.Shutdown(shutdown)
+	}()
+	if err := server.Serve(ln); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestServeAPI(t *testing.T) {
+	root := makeTree(t, map[string]string{
+		"build/app":          "binary",
+		"build/logs/out.log": "log",
+		"build/tmp/x":        "x",
+		"build/a/b/c/deep":   "deep",
+		"src/main.go":        "package main",
+	})
+	outside := makeTree(t, map[string]string{"secret.txt": "secret"})
+	if err := os.Symlink(outside, filepath.Join(root, "build", "elsewhere")); err != nil {
+		t.Fatal(err)
+	}
+	src, err := openSource(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer src.Close()
+	opts := options{printFiles: true, format: formatText, links: linksInside, exclude: []string{"tmp"}, maxDepth: 3}
+	s, err := newTreeServer(src, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(s.handler())
+	defer server.Close()
+
+	cases := []struct {
+		path    string
+		status  int
+		entries []string // "name type lazy"
+	}{
+		{"", http.StatusOK, []string{"build directory true", "src directory true"}},
+		{"build", http.StatusOK, []string{"a directory true", "app file false", "elsewhere link false", "logs directory true"}},
+		{"build/a", http.StatusOK, []string{"b directory false"}}, // at the depth limit
+		{"build/a/b", http.StatusNotFound, nil},
+		{"build/tmp", http.StatusNotFound, nil},       // excluded
+		{"build/elsewhere", http.StatusNotFound, nil}, // outside the root
+		{"build/app", http.StatusNotFound, nil},
+		{"../" + filepath.Base(outside), http.StatusBadRequest, nil},
+		{"/etc", http.StatusBadRequest, nil},
+	}
+	for _, c := range cases {
+		resp, err := http.Get(server.URL + "/api/tree?path=" + c.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var dir apiDir
+		err = json.NewDecoder(resp.Body).Decode(&dir)
+		resp.Body.Close()
+		if resp.StatusCode != c.status {
+			t.Errorf("%q: status %d, expected %d", c.path, resp.StatusCode, c.status)
+			continue
+		}
+		if c.status != http.StatusOK {
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%q: invalid JSON: %v", c.path, err)
+		}
+		var entries []string
+		for _, entry := range dir.Entries {
+			entries = append(entries, strings.Join([]string{entry.Name, entry.Type, strconv.FormatBool(entry.Lazy)}, " "))
+		}
+		if strings.Join(entries, "\n") != strings.Join(c.entries, "\n") {
+			t.Errorf("%q: results not match\nGot:\n%v\nExpected:\n%v", c.path, entries, c.entries)
+		}
+	}
+
+	resp, err := http.Get(server.URL + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	page, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if !strings.Contains(string(page), `<details data-path="build">`) {
+		t.Errorf("page lacks the lazy root entries:\n%s", page)
+	}
+	resp, err = http.Post(server.URL+"/api/tree", "text/plain", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("POST: status %d", resp.StatusCode)
+	}
+}
+
+func TestServeShutdown(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- serveTree(ctx, io.Discard, "127.0.0.1:0", "testdata", options{format: formatText, links: linksInside})
+	}()
+	cancel()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("server did not stop")
+	}
+}
@@ -0,0 +1,336 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+)
+
+// Snapshot layout, all integers big-endian or (u)varint:
+//
+//	magic "TREESNAP", version byte, flags byte, payload length uint64
+//	payload: the root entry, every directory followed by its entries
+//	crc32 (IEEE) of everything before it
+//
+// An entry is a flags byte (entry*), name, size, mtime (unix seconds and
+// nanoseconds), mode, link target, notes, the sha256 if entryHash is set and,
+// for directories, the number of entries and the entries.
+const (
+	snapshotMagic   = "TREESNAP"
+	snapshotVersion = 1
+	snapshotHeader  = len(snapshotMagic) + 2 + 8
+	snapshotExt     = ".snap" // only read as a snapshot if it starts like one
+
+	snapshotHashes = 1 << 0 // header flag: files carry hashes
+
+	entryDir      = 1 << 0
+	entryLinkOnly = 1 << 1
+	entryHash     = 1 << 2
+	entryInfo     = 1 << 3 // mode and mtime are known
+
+	maxSnapshotDepth = 4096 // deeper nesting only comes from a broken file
+)
+
+var errSnapshotFiles = errors.New("a snapshot has names and sizes, not the files")
+
+// a saved tree is walked already
+func (src *source) needFiles() error {
+	if src.tree != nil {
+		return fmt.Errorf("%s: %v", src.label, errSnapshotFiles)
+	}
+	return nil
+}
+
+// sha256 of every regular file, stored with the tree (--hashes)
+func hashTree(src *source, root *dirFile, opts options) error {
+	if err := src.needFiles(); err != nil {
+		return err
+	}
+	var errs walkErrors
+	var hash func(dir *dirFile, rel string) error
+	hash = func(dir *dirFile, rel string) error {
+		for _, entry := range dir.subDirFiles {
+			entryRel := joinRel(rel, entry.name)
+			switch {
+			case entry.isDir && !entry.linkOnly:
+				if err := hash(entry, entryRel); err != nil {
+					return err
+				}
+			case entry.linkOnly, entry.isDir, entry.info == nil:
+			default:
+				name := path.Join(src.root, entryRel)
+				sum, err := hashFile(src.fsys, name, -1)
+				if err != nil && !opts.keepGoing {
+					return err
+				}
+				if err != nil {
+					entry.notes = append(entry.notes, errorLabel(err))
+					errs = append(errs, walkError{path: src.display(name), err: err})
+					continue
+				}
+				entry.hash = sum[:]
+			}
+		}
+		return nil
+	}
+	if err := hash(root, ""); err != nil {
+		return err
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+func writeSnapshot(out io.Writer, root *dirFile, opts options) error {
+	var flags byte
+	if opts.hashes {
+		flags |= snapshotHashes
+	}
+	payload := appendEntry(nil, root)
+	buf := make([]byte, 0, snapshotHeader+len(payload)+4)
+	buf = append(buf, snapshotMagic...)
+	buf = append(buf, snapshotVersion, flags)
+	buf = binary.BigEndian.AppendUint64(buf, uint64(len(payload)))
+	buf = append(buf, payload...)
+	buf = binary.BigEndian.AppendUint32(buf, crc32.ChecksumIEEE(buf))
+	_, err := out.Write(buf)
+	return err
+}
+
+func appendEntry(buf []byte, entry *dirFile) []byte {
+	var flags byte
+	if entry.isDir {
+		flags |= entryDir
+	}
+	if entry.linkOnly {
+		flags |= entryLinkOnly
+	}
+	if len(entry.hash) == sha256.Size {
+		flags |= entryHash
+	}
+	if entry.info != nil {
+		flags |= entryInfo
+	}
+	buf = append(buf, flags)
+	buf = appendString(buf, entry.name)
+	buf = binary.AppendUvarint(buf, uint64(entry.size))
+	if entry.info != nil {
+		buf = binary.AppendVarint(buf, entry.modTime.Unix())
+		buf = binary.AppendUvarint(buf, uint64(entry.modTime.Nanosecond()))
+		buf = binary.AppendUvarint(buf, uint64(entry.info.Mode()))
+	}
+	buf = appendString(buf, entry.linkTarget)
+	buf = binary.AppendUvarint(buf, uint64(len(entry.notes)))
+	for _, note := range entry.notes {
+		buf = appendString(buf, note)
+	}
+	if flags&entryHash != 0 {
+		buf = append(buf, entry.hash...)
+	}
+	if entry.isDir {
+		buf = binary.AppendUvarint(buf, uint64(len(entry.subDirFiles)))
+		for _, sub := range entry.subDirFiles {
+			buf = appendEntry(buf, sub)
+		}
+	}
+	return buf
+}
+
+func appendString(buf []byte, s string) []byte {
+	return append(binary.AppendUvarint(buf, uint64(len(s))), s...)
+}
+
+// the tree saved in the file at name; nil without an error if the file is
+// no snapshot at all. A .snap file cut short inside the magic is reported as
+// truncated; any other file that short is just a file.
+func openSnapshot(name string) (*dirFile, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	magic := make([]byte, len(snapshotMagic))
+	n, _ := io.ReadFull(f, magic) // directories and empty files read nothing
+	switch {
+	case string(magic[:n]) == snapshotMagic:
+	case n > 0 && bytes.HasPrefix([]byte(snapshotMagic), magic[:n]) && filepath.Ext(name) == snapshotExt:
+	default:
+		return nil, nil
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	tree, err := readSnapshot(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", name, err)
+	}
+	return tree, nil
+}
+
+func readSnapshot(in io.Reader) (*dirFile, error) {
+	data, err := io.ReadAll(in)
+	if err != nil {
+		return nil, err
+	}
+	magic := []byte(snapshotMagic)
+	switch {
+	case len(data) > 0 && len(data) < len(magic) && bytes.HasPrefix(magic, data):
+		return nil, errors.New("truncated snapshot: incomplete header")
+	case !bytes.HasPrefix(data, magic):
+		return nil, errors.New("not a tree snapshot")
+	case len(data) < snapshotHeader:
+		return nil, errors.New("truncated snapshot: incomplete header")
+	}
+	if version := data[len(snapshotMagic)]; version > snapshotVersion {
+		return nil, fmt.Errorf("unsupported snapshot version %d (up to %d is supported)", version, snapshotVersion)
+	}
+	length := binary.BigEndian.Uint64(data[snapshotHeader-8:])
+	if available := uint64(len(data) - snapshotHeader); length > available || available-length < 4 {
+		return nil, fmt.Errorf("truncated snapshot: %d of %d bytes", len(data), uint64(snapshotHeader)+length+4)
+	} else if available-length > 4 {
+		return nil, errors.New("corrupt snapshot: trailing data")
+	}
+	end := snapshotHeader + int(length)
+	if crc32.ChecksumIEEE(data[:end]) != binary.BigEndian.Uint32(data[end:]) {
+		return nil, errors.New("corrupt snapshot: checksum mismatch")
+	}
+
+	r := &snapshotReader{data: data[snapshotHeader:end]}
+	root := r.entry(0)
+	if r.err == nil && len(r.data) > 0 {
+		r.err = errors.New("data after the root entry")
+	}
+	if r.err != nil {
+		return nil, fmt.Errorf("corrupt snapshot: %v", r.err)
+	}
+	return root, nil
+}
+
+// decodes the payload; the first error sticks and everything after is zero
+type snapshotReader struct {
+	data []byte
+	err  error
+}
+
+func (r *snapshotReader) fail(err error) {
+	if r.err == nil {
+		r.err = err
+	}
+	r.data = nil
+}
+
+func (r *snapshotReader) bytes(n uint64) []byte {
+	if n > uint64(len(r.data)) {
+		r.fail(io.ErrUnexpectedEOF)
+		return nil
+	}
+	b := r.data[:n]
+	r.data = r.data[n:]
+	return b
+}
+
+func (r *snapshotReader) uvarint() uint64 {
+	v, n := binary.Uvarint(r.data)
+	if n <= 0 {
+		r.fail(errors.New("bad number"))
+		return 0
+	}
+	r.data = r.data[n:]
+	return v
+}
+
+func (r *snapshotReader) varint() int64 {
+	v, n := binary.Varint(r.data)
+	if n <= 0 {
+		r.fail(errors.New("bad number"))
+		return 0
+	}
+	r.data = r.data[n:]
+	return v
+}
+
+func (r *snapshotReader) string() string {
+	return string(r.bytes(r.uvarint()))
+}
+
+func (r *snapshotReader) entry(depth int) *dirFile {
+	if depth > maxSnapshotDepth {
+		r.fail(errors.New("too deeply nested"))
+		return nil
+	}
+	flags := r.bytes(1)
+	if r.err != nil {
+		return nil
+	}
+	entry := &dirFile{isDir: flags[0]&entryDir != 0, linkOnly: flags[0]&entryLinkOnly != 0}
+	entry.name = r.string()
+	entry.size = int64(r.uvarint())
+	if flags[0]&entryInfo != 0 {
+		sec, nsec := r.varint(), r.uvarint()
+		entry.modTime = time.Unix(sec, int64(nsec))
+		entry.info = snapshotInfo{entry: entry, mode: fs.FileMode(r.uvarint())}
+	}
+	entry.linkTarget = r.string()
+	if notes := r.uvarint(); notes > uint64(len(r.data)) {
+		r.fail(io.ErrUnexpectedEOF)
+	} else {
+		for i := uint64(0); i < notes; i++ {
+			entry.notes = append(entry.notes, r.string())
+		}
+	}
+	if flags[0]&entryHash != 0 {
+		entry.hash = r.bytes(sha256.Size)
+	}
+	if entry.isDir {
+		count := r.uvarint()
+		if count > uint64(len(r.data)) { // every entry takes a byte at least
+			r.fail(io.ErrUnexpectedEOF)
+		}
+		for i := uint64(0); i < count && r.err == nil; i++ {
+			entry.subDirFiles = append(entry.subDirFiles, r.entry(depth+1))
+		}
+	}
+	if r.err != nil {
+		return nil
+	}
+	return entry
+}
+
+// what the walk knew about the entry, for the columns and colors
+type snapshotInfo struct {
+	entry *dirFile
+	mode  fs.FileMode
+}
+
+func (fi snapshotInfo) Name() string       { return fi.entry.name }
+func (fi snapshotInfo) Size() int64        { return fi.entry.size }
+func (fi snapshotInfo) Mode() fs.FileMode  { return fi.mode }
+func (fi snapshotInfo) ModTime() time.Time { return fi.entry.modTime }
+func (fi snapshotInfo) IsDir() bool        { return fi.mode.IsDir() }
+func (fi snapshotInfo) Sys() any           { return nil }
+
+// -I/-P on a loaded tree; .gitignore files are not in the snapshot
+func pruneSnapshot(dir *dirFile, rel string, opts options) {
+	kept := dir.subDirFiles[:0]
+	for _, entry := range dir.subDirFiles {
+		entryRel := joinRel(rel, entry.name)
+		if opts.pruned(entryRel, entry.isDir, nil) {
+			continue
+		}
+		if entry.isDir {
+			pruneSnapshot(entry, entryRel, opts)
+		}
+		kept = append(kept, entry)
+	}
+	dir.subDirFiles = kept
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// save the walk of root with opts and write it next to it
+func saveSnapshot(t *testing.T, root string, opts options) string {
+	out := new(bytes.Buffer)
+	opts.format = formatSnapshot
+	if err := dirTreeWith(out, root, opts); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	name := filepath.Join(t.TempDir(), "tree.snap")
+	if err := os.WriteFile(name, out.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return name
+}
+
+func TestSnapshotRoundTrip(t *testing.T) {
+	root := makeTree(t, map[string]string{
+		"bin/tool":        "#!/bin/sh",
+		"data/a.csv":      "1,2,3",
+		"data/b.csv":      "4,5",
+		"data/empty/":     "",
+		"docs/readme.txt": "read me",
+	})
+	if err := os.Symlink("../data", filepath.Join(root, "docs", "data")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("missing", filepath.Join(root, "dangling")); err != nil {
+		t.Fatal(err)
+	}
+	for _, opts := range []options{
+		{printFiles: true, links: linksShow, columns: columns{perms: true, date: true, timeFormat: "2006-01-02T15:04:05.000000000"}},
+		{printFiles: true, links: linksFollow, du: true, human: true, sortBy: sortBySize, dirsFirst: true},
+		{printFiles: true, links: linksFollow, maxDepth: 1},
+	} {
+		opts.format = formatText
+		snapshot := saveSnapshot(t, root, opts)
+		expected := treeString(t, root, opts)
+		if result := treeString(t, snapshot, opts); result != expected {
+			t.Errorf("results not match\nGot:\n%v\nExpected:\n%v", result, expected)
+		}
+	}
+
+	// filters apply to the loaded tree as they do to a walk
+	snapshot := saveSnapshot(t, root, options{printFiles: true, links: linksShow})
+	opts := options{printFiles: true, format: formatText, links: linksShow, exclude: []string{"docs"}, include: []string{"*.csv"}}
+	expected := `├───bin
+└───data
+	├───a.csv (5b)
+	├───b.csv (3b)
+	└───empty
+`
+	if result := treeString(t, snapshot, opts); result != expected {
+		t.Errorf("results not match\nGot:\n%v\nExpected:\n%v", result, expected)
+	}
+}
+
+func TestSnapshotHashes(t *testing.T) {
+	root := makeTree(t, map[string]string{"a.txt": "aaa", "b.txt": "bbb", "sub/c.txt": "ccc"})
+	snapshot := saveSnapshot(t, root, options{printFiles: true, hashes: true})
+	tree, err := loadTree(snapshot, options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tree.subDirFiles) != 3 || len(tree.subDirFiles[0].hash) != 32 || tree.subDirFiles[2].subDirFiles[0].hash == nil {
+		t.Fatalf("hashes missing: %+v", tree.subDirFiles)
+	}
+
+	// same sizes, other content: only the hashes tell
+	if err := os.WriteFile(filepath.Join(root, "b.txt"), []byte("BBB"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	out := new(bytes.Buffer)
+	changed, err := treeDiff(out, snapshot, root, options{printFiles: true, format: formatText, hashes: true})
+	if err != nil || !changed {
+		t.Fatalf("changed %v, error %v", changed, err)
+	}
+	expected := `├───a.txt (3b)
+├───b.txt (3b) [content changed]
+└───sub
+	└───c.txt (3b)
+`
+	if result := out.String(); result != expected {
+		t.Errorf("results not match\nGot:\n%v\nExpected:\n%v", result, expected)
+	}
+}
+
+func TestSnapshotCorrupt(t *testing.T) {
+	root := makeTree(t, map[string]string{"dir/file.txt": "content", "other.txt": "x"})
+	data, err := os.ReadFile(saveSnapshot(t, root, options{printFiles: true, hashes: true}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := readSnapshot(bytes.NewReader(data)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for size := 0; size < len(data); size++ {
+		_, err := readSnapshot(bytes.NewReader(data[:size]))
+		if err == nil || size > 0 && !strings.Contains(err.Error(), "truncated") {
+			t.Errorf("%d of %d bytes: got error %v", size, len(data), err)
+		}
+	}
+	// the same files given to the command, cut inside the magic too
+	truncated := filepath.Join(t.TempDir(), "truncated.snap")
+	for size := 1; size < len(data); size++ {
+		if err := os.WriteFile(truncated, data[:size], 0644); err != nil {
+			t.Fatal(err)
+		}
+		err := dirTreeWith(new(bytes.Buffer), truncated, options{format: formatText})
+		if err == nil || !strings.Contains(err.Error(), "truncated") {
+			t.Errorf("%s, %d of %d bytes: got error %v", truncated, size, len(data), err)
+		}
+	}
+	for idx := len(snapshotMagic) + 1; idx < len(data); idx++ {
+		broken := append([]byte(nil), data...)
+		broken[idx] ^= 0x40
+		if _, err := readSnapshot(bytes.NewReader(broken)); err == nil {
+			t.Errorf("byte %d flipped: no error", idx)
+		}
+	}
+
+	cases := map[string][]byte{
+		"not a tree snapshot":            []byte(`{"name": "saved.json"}`),
+		"unsupported snapshot version 9": append(append([]byte(snapshotMagic), 9), data[len(snapshotMagic)+1:]...),
+		"trailing data":                  append(append([]byte(nil), data...), 0),
+	}
+	for expected, input := range cases {
+		if _, err := readSnapshot(bytes.NewReader(input)); err == nil || !strings.Contains(err.Error(), expected) {
+			t.Errorf("got error %v, expected %q", err, expected)
+		}
+	}
+}
+
+// a short file that starts like the magic is only a snapshot by its name
+func TestSnapshotShortFile(t *testing.T) {
+	dir := t.TempDir()
+	notes := filepath.Join(dir, "notes.txt")
+	if err := os.WriteFile(notes, []byte("TREE"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	out := new(bytes.Buffer)
+	if err := dirTreeWith(out, notes, options{format: formatJSON}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := `{
+  "name": "notes.txt",
+  "type": "file",
+  "size": 4
+}
+`
+	if result := out.String(); result != expected {
+		t.Errorf("results not match\nGot:\n%v\nExpected:\n%v", result, expected)
+	}
+
+	cut := filepath.Join(dir, "cut.snap")
+	if err := os.WriteFile(cut, []byte("TREE"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := dirTreeWith(new(bytes.Buffer), cut, options{format: formatText}); err == nil || !strings.Contains(err.Error(), "truncated") {
+		t.Errorf("%s: got error %v", cut, err)
+	}
+}
+
+func TestSnapshotNeedsFiles(t *testing.T) {
+	snapshot := saveSnapshot(t, "testdata/project", options{printFiles: true})
+	for _, opts := range []options{
+		{dups: true},
+		{grep: regexp.MustCompile("x")},
+	} {
+		opts.format = formatText
+		if err := dirTreeWith(new(bytes.Buffer), snapshot, opts); err == nil || !strings.Contains(err.Error(), "not the files") {
+			t.Errorf("%+v: got error %v", opts, err)
+		}
+	}
+	// loaded trees are in memory anyway
+	if result := treeString(t, snapshot, options{printFiles: true, format: formatText, stream: true}); result != "├───file.txt (19b)\n└───gopher.png (70372b)\n" {
+		t.Errorf("unexpected output:\n%v", result)
+	}
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"path/filepath"
+	"sort"
+)
+
+// sort keys
+const (
+	sortByName    = "name"
+	sortBySize    = "size"    // directories by their recursive size
+	sortByTime    = "mtime"   // oldest first
+	sortByExt     = "ext"     // then by name
+	sortByVersion = "version" // natural order: file2 before file10
+)
+
+// order entries in place; the default is lexicographical (i.e alphabetical)
+func sortFiles(files []*dirFile, opts options) {
+	sort.SliceStable(files, func(i, j int) bool {
+		a, b := files[i], files[j]
+		if opts.dirsFirst && a.isDir != b.isDir {
+			return a.isDir // grouping is not affected by -r
+		}
+		cmp := compareFiles(a, b, opts.sortBy)
+		if opts.reverse {
+			return cmp > 0
+		}
+		return cmp < 0
+	})
+}
+
+// <0, 0, >0; ties are broken by name so every key gives a stable order
+func compareFiles(a, b *dirFile, key string) int {
+	var cmp int
+	switch key {
+	case sortBySize:
+		cmp = compareInt(a.totalSize, b.totalSize)
+	case sortByTime:
+		cmp = a.modTime.Compare(b.modTime)
+	case sortByExt:
+		cmp = compareString(filepath.Ext(a.name), filepath.Ext(b.name))
+	case sortByVersion:
+		cmp = compareNatural(a.name, b.name)
+	}
+	if cmp == 0 {
+		cmp = compareString(a.name, b.name)
+	}
+	return cmp
+}
+
+func compareInt(a, b int64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+func compareString(a, b string) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// compare runs of digits by their numeric value, everything else bytewise
+func compareNatural(a, b string) int {
+	for a != "" && b != "" {
+		if isDigit(a[0]) && isDigit(b[0]) {
+			numA, restA := digitRun(a)
+			numB, restB := digitRun(b)
+			// longer number (without leading zeros) is bigger
+			if cmp := compareInt(int64(len(numA)), int64(len(numB))); cmp != 0 {
+				return cmp
+			}
+			if cmp := compareString(numA, numB); cmp != 0 {
+				return cmp
+			}
+			a, b = restA, restB
+			continue
+		}
+		if a[0] != b[0] {
+			return compareInt(int64(a[0]), int64(b[0]))
+		}
+		a, b = a[1:], b[1:]
+	}
+	return compareInt(int64(len(a)), int64(len(b)))
+}
+
+func isDigit(c byte) bool {
+	return '0' <= c && c <= '9'
+}
+
+// split "007abc" into "7" (leading zeros dropped) and "abc"
+func digitRun(s string) (string, string) {
+	end := 0
+	for end < len(s) && isDigit(s[end]) {
+		end++
+	}
+	num := s[:end]
+	for len(num) > 1 && num[0] == '0' {
+		num = num[1:]
+	}
+	return num, s[end:]
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSortOrders(t *testing.T) {
+	root := makeTree(t, map[string]string{
+		"file10.txt":  "1234567890",
+		"file2.txt":   "12",
+		"file1.go":    "1",
+		"dir3/a.txt":  "123",
+		"dir20/b.txt": "12345",
+	})
+	// mtime order: file2.txt, dir20, file10.txt, dir3, file1.go
+	base := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i, name := range []string{"file2.txt", "dir20", "file10.txt", "dir3", "file1.go"} {
+		mtime := base.Add(time.Duration(i) * time.Hour)
+		if err := os.Chtimes(filepath.Join(root, name), mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cases := []struct {
+		opts     options
+		expected string
+	}{
+		{options{sortBy: sortByVersion}, `├───dir3
+│	└───a.txt (3b)
+├───dir20
+│	└───b.txt (5b)
+├───file1.go (1b)
+├───file2.txt (2b)
+└───file10.txt (10b)
+`},
+		{options{sortBy: sortBySize, reverse: true}, `├───file10.txt (10b)
+├───dir20
+│	└───b.txt (5b)
+├───dir3
+│	└───a.txt (3b)
+├───file2.txt (2b)
+└───file1.go (1b)
+`},
+		{options{sortBy: sortByTime}, `├───file2.txt (2b)
+├───dir20
+│	└───b.txt (5b)
+├───file10.txt (10b)
+├───dir3
+│	└───a.txt (3b)
+└───file1.go (1b)
+`},
+		{options{sortBy: sortByExt, dirsFirst: true}, `├───dir20
+│	└───b.txt (5b)
+├───dir3
+│	└───a.txt (3b)
+├───file1.go (1b)
+├───file10.txt (10b)
+└───file2.txt (2b)
+`},
+		{options{sortBy: sortByVersion, dirsFirst: true, reverse: true}, `├───dir20
+│	└───b.txt (5b)
+├───dir3
+│	└───a.txt (3b)
+├───file10.txt (10b)
+├───file2.txt (2b)
+└───file1.go (1b)
+`},
+	}
+	for _, c := range cases {
+		c.opts.printFiles = true
+		c.opts.format = formatText
+		if result := treeString(t, root, c.opts); result != c.expected {
+			t.Errorf("%+v: results not match\nGot:\n%v\nExpected:\n%v", c.opts, result, c.expected)
+		}
+	}
+}
+
+// the last listed entry gets └─── even when files sort after the directories
+func TestSortLastEntry(t *testing.T) {
+	root := makeTree(t, map[string]string{
+		"a.txt":     "1",
+		"b/c.txt":   "1",
+		"d/e.txt":   "1",
+		"zzz.txt":   "1",
+		"d/f/g.txt": "1",
+	})
+	opts := options{format: formatText, dirsFirst: true, reverse: true}
+	expected := `├───d
+│	└───f
+└───b
+`
+	if result := treeString(t, root, opts); result != expected {
+		t.Errorf("results not match\nGot:\n%v\nExpected:\n%v", result, expected)
+	}
+}
+
+func TestCompareNatural(t *testing.T) {
+	ordered := []string{"", "a", "a1", "a01b", "a2", "a10", "a10b", "b", "v1.2.9", "v1.10.0"}
+	for i := 1; i < len(ordered); i++ {
+		if compareNatural(ordered[i-1], ordered[i]) >= 0 {
+			t.Errorf("expected %q < %q", ordered[i-1], ordered[i])
+		}
+		if compareNatural(ordered[i], ordered[i-1]) <= 0 {
+			t.Errorf("expected %q > %q", ordered[i], ordered[i-1])
+		}
+	}
+}
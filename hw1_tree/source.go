@@ -0,0 +1,65 @@
+package main
+
+import (
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// a file system to walk and where in it to start
+type source struct {
+	fsys   fs.FS
+	root   string    // fs name of the root entry, "." mostly
+	name   string    // shown for the root entry
+	label  string    // root of the paths in error messages
+	osDir  string    // OS directory behind fsys ("" for archives and friends)
+	closer io.Closer // archives only
+	tree   *dirFile  // a loaded snapshot: walked already, fsys is nil
+}
+
+// a directory, a single file, a .zip/.tar/.tar.gz archive or a snapshot on disk
+func openSource(path string) (*source, error) {
+	abs, err := filepath.Abs(path) // get the absolute path
+	if err != nil {
+		return nil, err
+	}
+	info, err := os.Stat(abs)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		return &source{fsys: os.DirFS(abs), root: ".", name: info.Name(), label: abs, osDir: abs}, nil
+	}
+
+	tree, err := openSnapshot(abs)
+	if err != nil {
+		return nil, err
+	}
+	if tree != nil {
+		return &source{root: ".", name: tree.name, label: abs, tree: tree}, nil
+	}
+
+	fsys, closer, err := openArchive(abs)
+	if err != nil {
+		return nil, err
+	}
+	if fsys != nil {
+		return &source{fsys: fsys, root: ".", name: info.Name(), label: abs, closer: closer}, nil
+	}
+	// any other file is listed from its directory
+	dir := filepath.Dir(abs)
+	return &source{fsys: os.DirFS(dir), root: info.Name(), name: info.Name(), label: dir, osDir: dir}, nil
+}
+
+func (src *source) Close() error {
+	if src.closer == nil {
+		return nil
+	}
+	return src.closer.Close()
+}
+
+// path of an fs name for error messages
+func (src *source) display(name string) string {
+	return filepath.Join(src.label, filepath.FromSlash(name))
+}
@@ -0,0 +1,321 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+var testFS = fstest.MapFS{
+	"docs/readme.md":  {Data: []byte("# docs")},
+	"docs/empty.txt":  {},
+	"src/main.go":     {Data: []byte("package main")},
+	"src/lib/lib.go":  {Data: []byte("package lib")},
+	"src/current":     {Data: []byte("lib"), Mode: fs.ModeSymlink},
+	"src/lib/up":      {Data: []byte(".."), Mode: fs.ModeSymlink},
+	"src/lib/missing": {Data: []byte("../nowhere"), Mode: fs.ModeSymlink},
+}
+
+func TestTreeFS(t *testing.T) {
+	out := new(bytes.Buffer)
+	opts := options{printFiles: true, format: formatText, links: linksFollow}
+	if err := dirTreeFS(out, testFS, opts); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// no inodes in a MapFS: loops are found by the resolved names
+	expected := `├───docs
+│	├───empty.txt (empty)
+│	└───readme.md (6b)
+└───src
+	├───current -> lib
+	│	├───lib.go (11b)
+	│	├───missing -> ../nowhere [broken link]
+	│	└───up -> .. [recursive, not followed]
+	├───lib
+	│	├───lib.go (11b)
+	│	├───missing -> ../nowhere [broken link]
+	│	└───up -> .. [recursive, not followed]
+	└───main.go (12b)
+`
+	if result := out.String(); result != expected {
+		t.Errorf("results not match\nGot:\n%v\nExpected:\n%v", result, expected)
+	}
+
+	out.Reset()
+	opts = options{printFiles: true, format: formatText, links: linksShow, maxDepth: 2}
+	if err := dirTreeFS(out, testFS, opts); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected = `├───docs
+│	├───empty.txt (empty)
+│	└───readme.md (6b)
+└───src
+	├───current -> lib
+	├───lib
+	└───main.go (12b)
+`
+	if result := out.String(); result != expected {
+		t.Errorf("results not match\nGot:\n%v\nExpected:\n%v", result, expected)
+	}
+}
+
+// a MapFS that fails to list some directories and remembers what was listed
+type faultyFS struct {
+	fstest.MapFS
+	broken map[string]bool
+
+	mu     sync.Mutex
+	listed []string
+}
+
+func (f *faultyFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	f.mu.Lock()
+	f.listed = append(f.listed, name)
+	f.mu.Unlock()
+	if f.broken[name] {
+		return nil, &fs.PathError{Op: "readdirent", Path: name, Err: fs.ErrPermission}
+	}
+	return f.MapFS.ReadDir(name)
+}
+
+func TestKeepGoingFS(t *testing.T) {
+	fsys := &faultyFS{
+		MapFS: fstest.MapFS{
+			"a/file.txt":        {Data: []byte("a")},
+			"locked/file.txt":   {Data: []byte("b")},
+			"z/deep/locked/x":   {Data: []byte("c")},
+			"z/deep/file.txt":   {Data: []byte("d")},
+			"node_modules/x.js": {Data: []byte("e")},
+		},
+		broken: map[string]bool{"locked": true, "z/deep/locked": true},
+	}
+	for _, workers := range []int{1, 4} {
+		out := new(bytes.Buffer)
+		opts := options{printFiles: true, format: formatText, keepGoing: true, workers: workers,
+			exclude: []string{"node_modules"},
+		}
+		err := dirTreeFS(out, fsys, opts)
+		errs, ok := err.(walkErrors)
+		if !ok || len(errs) != 2 || errs[0].path != "locked" || errs[1].path != filepath.FromSlash("z/deep/locked") {
+			t.Fatalf("expected two errors, got %#v", err)
+		}
+		expected := `├───a
+│	└───file.txt (1b)
+├───locked [permission denied]
+└───z
+	└───deep
+		├───file.txt (1b)
+		└───locked [permission denied]
+`
+		if result := out.String(); result != expected {
+			t.Errorf("results not match\nGot:\n%v\nExpected:\n%v", result, expected)
+		}
+	}
+	for _, name := range fsys.listed {
+		if name == "node_modules" {
+			t.Errorf("pruned directory %s was listed", name)
+		}
+	}
+
+	// without -k the first error ends the walk
+	if err := dirTreeFS(new(bytes.Buffer), fsys, options{format: formatText}); err == nil {
+		t.Errorf("expected an error")
+	}
+}
+
+const testArchiveResult = `├───bin
+│	├───tool (8b)
+│	└───tool-link -> tool (8b)
+├───docs
+│	├───copy.txt (5b)
+│	└───readme.txt (5b)
+└───empty
+`
+
+func TestTreeTarGz(t *testing.T) {
+	buf := new(bytes.Buffer)
+	gz := gzip.NewWriter(buf)
+	tw := tar.NewWriter(gz)
+	mtime := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	headers := []struct {
+		hdr  tar.Header
+		data string
+	}{
+		{tar.Header{Name: "./empty/", Typeflag: tar.TypeDir, Mode: 0755}, ""},
+		// bin/ and docs/ are only implied
+		{tar.Header{Name: "bin/tool", Typeflag: tar.TypeReg, Mode: 0755}, "#!/bin/x"},
+		{tar.Header{Name: "bin/tool-link", Typeflag: tar.TypeSymlink, Linkname: "tool"}, ""},
+		{tar.Header{Name: "docs/readme.txt", Typeflag: tar.TypeReg, Mode: 0644}, "hello"},
+		{tar.Header{Name: "docs/copy.txt", Typeflag: tar.TypeLink, Linkname: "docs/readme.txt"}, ""},
+		{tar.Header{Name: "../escape.txt", Typeflag: tar.TypeReg, Mode: 0644}, "evil"},
+	}
+	for _, h := range headers {
+		h.hdr.Size = int64(len(h.data))
+		h.hdr.ModTime = mtime
+		if err := tw.WriteHeader(&h.hdr); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(h.data)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	archive := filepath.Join(t.TempDir(), "release.tar.gz")
+	if err := os.WriteFile(archive, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if result := treeString(t, archive, options{printFiles: true, format: formatText}); result != testArchiveResult {
+		t.Errorf("results not match\nGot:\n%v\nExpected:\n%v", result, testArchiveResult)
+	}
+}
+
+func TestTreeZip(t *testing.T) {
+	buf := new(bytes.Buffer)
+	zw := zip.NewWriter(buf)
+	// as zip -ry stores them: a link is its target as the content
+	entries := []struct {
+		name string
+		mode fs.FileMode
+		data string
+	}{
+		{"bin/tool", 0755, "#!/bin/x"},
+		{"bin/tool-link", fs.ModeSymlink | 0777, "tool"},
+		{"docs/readme.txt", 0644, "hello"},
+		{"docs/copy.txt", 0644, "hello"},
+		{"empty/", fs.ModeDir | 0755, ""},
+	}
+	for _, e := range entries {
+		hdr := &zip.FileHeader{Name: e.name, Method: zip.Deflate}
+		hdr.SetMode(e.mode)
+		w, err := zw.CreateHeader(hdr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write([]byte(e.data)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	archive := filepath.Join(t.TempDir(), "release.zip")
+	if err := os.WriteFile(archive, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if result := treeString(t, archive, options{printFiles: true, format: formatText}); result != testArchiveResult {
+		t.Errorf("results not match\nGot:\n%v\nExpected:\n%v", result, testArchiveResult)
+	}
+
+	fsys, closer, err := openArchive(archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer closer.Close()
+	if err := fstest.TestFS(fsys, "bin/tool", "bin/tool-link", "docs/copy.txt", "empty"); err != nil {
+		t.Error(err)
+	}
+}
+
+// links of an fs.FS that can not read them are listed, not followed
+func TestUnreadableLinks(t *testing.T) {
+	fsys := struct{ fs.FS }{fstest.MapFS{
+		"a.txt": {Data: []byte("a")},
+		"link":  {Data: []byte("a.txt"), Mode: fs.ModeSymlink | 0777},
+	}}
+	out := new(bytes.Buffer)
+	if err := dirTreeFS(out, fsys, options{printFiles: true, format: formatText}); err != nil {
+		t.Fatal(err)
+	}
+	expected := `├───a.txt (1b)
+└───link [link not readable]
+`
+	if result := out.String(); result != expected {
+		t.Errorf("results not match\nGot:\n%v\nExpected:\n%v", result, expected)
+	}
+}
+
+func TestTarFSConformance(t *testing.T) {
+	buf := new(bytes.Buffer)
+	tw := tar.NewWriter(buf)
+	for _, name := range []string{"a/b/c.txt", "a/d.txt", "e.txt"} {
+		if err := tw.WriteHeader(&tar.Header{Name: name, Typeflag: tar.TypeReg, Mode: 0644, Size: 1}); err != nil {
+			t.Fatal(err)
+		}
+		tw.Write([]byte("x"))
+	}
+	tw.Close()
+	data := buf.Bytes()
+	fsys, err := loadTar(func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(data)), nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := fstest.TestFS(fsys, "a/b/c.txt", "a/d.txt", "e.txt"); err != nil {
+		t.Error(err)
+	}
+}
+
+// a listing reads the headers only; opening a file reads the stream up to
+// that file, and its content only
+func TestTarLazyContent(t *testing.T) {
+	buf := new(bytes.Buffer)
+	tw := tar.NewWriter(buf)
+	tw.WriteHeader(&tar.Header{Name: "a.txt", Typeflag: tar.TypeReg, Mode: 0644, Size: 5})
+	tw.Write([]byte("hello"))
+	tw.Flush()
+	firstFile := buf.Len() // header and padded content of a.txt
+	tw.WriteHeader(&tar.Header{Name: "b.txt", Typeflag: tar.TypeLink, Linkname: "a.txt"})
+	tw.WriteHeader(&tar.Header{Name: "c.txt", Typeflag: tar.TypeReg, Mode: 0644, Size: 5})
+	tw.Write([]byte("world"))
+	tw.Close()
+	data := buf.Bytes()
+	reads := 0
+	fsys, err := loadTar(func() (io.ReadCloser, error) {
+		reads++
+		return io.NopCloser(bytes.NewReader(data)), nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out := new(bytes.Buffer)
+	if err := dirTreeFS(out, fsys, options{printFiles: true}); err != nil {
+		t.Fatal(err)
+	}
+	expected := "├───a.txt (5b)\n├───b.txt (5b)\n└───c.txt (5b)\n"
+	if out.String() != expected || reads != 1 {
+		t.Errorf("results not match\nGot:\n%v(%d reads)\nExpected:\n%v(1 read)", out, reads, expected)
+	}
+
+	// what comes after a.txt is gone: a.txt and its hard link are still there
+	data = data[:firstFile]
+	for _, name := range []string{"a.txt", "b.txt"} {
+		content, err := fs.ReadFile(fsys, name)
+		if err != nil || string(content) != "hello" {
+			t.Errorf("%s: results not match\nGot:\n%q %v\nExpected:\n%q", name, content, err, "hello")
+		}
+	}
+	if _, err := fs.ReadFile(fsys, "c.txt"); err == nil {
+		t.Errorf("c.txt: expected an error, the archive is cut before it")
+	}
+	if reads != 4 {
+		t.Errorf("results not match\nGot:\n%d reads\nExpected:\n4 reads", reads)
+	}
+}
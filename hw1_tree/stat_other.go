@@ -0,0 +1,23 @@
+//go:build !unix
+
+package main
+
+import "os"
+
+type fileID struct{}
+
+// no portable inode numbers: cycle detection is off
+func identify(info os.FileInfo) (fileID, bool) {
+	return fileID{}, false
+}
+
+type fileStat struct {
+	ino uint64
+	uid uint32
+	gid uint32
+}
+
+// no owners or inodes: the columns show "?"
+func statOf(info os.FileInfo) (fileStat, bool) {
+	return fileStat{}, false
+}
@@ -0,0 +1,37 @@
+//go:build unix
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// unique identity of a file on this machine
+type fileID struct {
+	dev uint64
+	ino uint64
+}
+
+func identify(info os.FileInfo) (fileID, bool) {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return fileID{}, false
+	}
+	return fileID{dev: uint64(stat.Dev), ino: uint64(stat.Ino)}, true
+}
+
+// the unix bits os.FileInfo does not carry
+type fileStat struct {
+	ino uint64
+	uid uint32
+	gid uint32
+}
+
+func statOf(info os.FileInfo) (fileStat, bool) {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return fileStat{}, false
+	}
+	return fileStat{ino: uint64(stat.Ino), uid: stat.Uid, gid: stat.Gid}, true
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+// rows of the extension and largest-file tables, --top changes it
+const defaultTop = 5
+
+// what the listed tree holds; only entries that were printed are counted
+type treeStats struct {
+	dirs    int
+	files   int
+	bytes   int64
+	exts    map[string]*extStats
+	sizes   []statFile // every counted file
+	deepest string
+	depth   int
+}
+
+type extStats struct {
+	ext   string // lower case, "" = none
+	count int
+	bytes int64
+}
+
+type statFile struct {
+	rel  string
+	size int64
+}
+
+func collectStats(root *dirFile, opts options) *treeStats {
+	st := &treeStats{exts: map[string]*extStats{}}
+	st.add(root, "", opts, 1)
+	return st
+}
+
+// mirrors printTreeFile: the same entries, the same depth limit
+func (st *treeStats) add(dir *dirFile, rel string, opts options, depth int) {
+	for _, entry := range dir.subDirFiles {
+		if !entry.isDir && !opts.printFiles {
+			continue
+		}
+		entryRel := joinRel(rel, entry.name)
+		if depth > st.depth {
+			st.depth, st.deepest = depth, entryRel
+		}
+		if entryType(entry) == typeDir {
+			st.dirs++
+			if opts.maxDepth == 0 || depth < opts.maxDepth {
+				st.add(entry, entryRel, opts, depth+1)
+			}
+			continue
+		}
+
+		st.files++ // links included, like tree(1)
+		if entry.linkOnly {
+			continue // no size of its own
+		}
+		st.bytes += entry.size
+		ext := extension(entry.name)
+		es := st.exts[ext]
+		if es == nil {
+			es = &extStats{ext: ext}
+			st.exts[ext] = es
+		}
+		es.count++
+		es.bytes += entry.size
+		st.sizes = append(st.sizes, statFile{rel: entryRel, size: entry.size})
+	}
+}
+
+// ".tar.gz" counts as ".gz"; dot files like ".profile" have none
+func extension(name string) string {
+	return strings.ToLower(path.Ext(strings.TrimLeft(name, ".")))
+}
+
+// the n extensions taking up the most space
+func (st *treeStats) topExts(n int) []*extStats {
+	exts := make([]*extStats, 0, len(st.exts))
+	for _, es := range st.exts {
+		exts = append(exts, es)
+	}
+	sort.Slice(exts, func(i, j int) bool {
+		if exts[i].bytes != exts[j].bytes {
+			return exts[i].bytes > exts[j].bytes
+		}
+		if exts[i].count != exts[j].count {
+			return exts[i].count > exts[j].count
+		}
+		return exts[i].ext < exts[j].ext
+	})
+	return exts[:min(n, len(exts))]
+}
+
+func (st *treeStats) largest(n int) []statFile {
+	files := append([]statFile(nil), st.sizes...)
+	sort.SliceStable(files, func(i, j int) bool {
+		return files[i].size > files[j].size // ties stay in tree order
+	})
+	return files[:min(n, len(files))]
+}
+
+// the footer after the text tree
+func writeStats(out io.Writer, st *treeStats, opts options) {
+	top := opts.statsTop
+	if top <= 0 {
+		top = defaultTop
+	}
+	buf := new(bytes.Buffer)
+	if !opts.printFiles {
+		fmt.Fprintf(buf, "\n%d directories\n", st.dirs)
+	} else {
+		fmt.Fprintf(buf, "\n%d directories, %d files, %s\n", st.dirs, st.files, formatSize(st.bytes, opts.human))
+	}
+
+	tw := tabwriter.NewWriter(buf, 0, 8, 2, ' ', 0)
+	if exts := st.topExts(top); len(exts) > 0 {
+		fmt.Fprintln(tw, "by extension:")
+		for _, es := range exts {
+			ext := es.ext
+			if ext == "" {
+				ext = "(none)"
+			}
+			fmt.Fprintf(tw, "\t%s\t%d file(s)\t%s\n", ext, es.count, formatSize(es.bytes, opts.human))
+		}
+	}
+	if files := st.largest(top); len(files) > 0 {
+		fmt.Fprintln(tw, "largest:")
+		for _, file := range files {
+			fmt.Fprintf(tw, "\t%s\t%s\n", formatSize(file.size, opts.human), file.rel)
+		}
+	}
+	tw.Flush()
+	if st.deepest != "" {
+		fmt.Fprintf(buf, "deepest: %s (%d levels)\n", st.deepest, st.depth)
+	}
+	out.Write(buf.Bytes())
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestStats(t *testing.T) {
+	root := makeTree(t, map[string]string{
+		".profile":             "export A=1",
+		"README":               "read me",
+		"docs/guide.md":        "# guide",
+		"docs/img/logo.PNG":    strings.Repeat("x", 2048),
+		"docs/img/raw/big.png": strings.Repeat("x", 4096),
+		"src/main.go":          "package main",
+		"src/util.go":          "package main // util",
+		"src/vendor/skip.go":   "package skip",
+	})
+	cases := []struct {
+		opts     options
+		expected string
+	}{
+		{options{printFiles: true, stats: true, statsTop: 3, exclude: []string{"vendor"}}, `
+4 directories, 7 files, 6.1KiB
+by extension:
+  .png    2 file(s)  6.0KiB
+  .go     2 file(s)  32b
+  (none)  2 file(s)  17b
+largest:
+  4.0KiB  docs/img/raw/big.png
+  2.0KiB  docs/img/logo.PNG
+  20b     src/util.go
+deepest: docs/img/raw/big.png (4 levels)
+`},
+		{options{printFiles: true, stats: true, maxDepth: 2, include: []string{"*.go"}}, `
+4 directories, 2 files, 32b
+by extension:
+  .go  2 file(s)  32b
+largest:
+  20b  src/util.go
+  12b  src/main.go
+deepest: docs/img (2 levels)
+`},
+		{options{stats: true}, `
+5 directories
+deepest: docs/img/raw (3 levels)
+`},
+	}
+	for _, c := range cases {
+		c.opts.format, c.opts.human = formatText, true
+		result := treeString(t, root, c.opts)
+		if idx := strings.Index(result, "\n\n"); idx < 0 || result[idx+1:] != c.expected {
+			t.Errorf("results not match\nGot:\n%v\nExpected:\n%v", result, c.expected)
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"sort"
+)
+
+// the options that need the whole tree before the first line is printed
+func checkStream(opts options) error {
+	switch {
+	case !opts.stream:
+		return nil
+	case opts.format != formatText:
+		return errors.New("--stream prints text only")
+	case opts.du, opts.sortBy == sortBySize:
+		return errors.New("--stream can not show or sort by directory totals")
+	case opts.dups, opts.stats, opts.watch, opts.grep != nil:
+		return errors.New("--stream can not be combined with --dups, --grep, --stats or --watch")
+	}
+	return nil
+}
+
+// print the tree while walking it, byte for byte what printTree prints.
+// Only the entries of the directories on the current path are held; every
+// printed directory is dropped. Without keep-going an error stops the walk
+// after part of the tree is out already.
+func streamTree(out io.Writer, src *source, opts options) error {
+	info, err := fs.Stat(src.fsys, src.root)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return nil // nothing below a file
+	}
+	w, err := newWalker(src, opts)
+	if err != nil {
+		return err
+	}
+	root := newDirFile(info)
+	root.name = src.name
+	subDirs, err := w.readDir(dirJob{node: root, real: src.root, ancestors: visit(nil, info, src.root)})
+	if err != nil {
+		return err
+	}
+
+	buf := bufio.NewWriter(out)
+	err = w.stream(buf, root, subDirs, "", 1)
+	if flushErr := buf.Flush(); err == nil {
+		err = flushErr
+	}
+	if err != nil {
+		return err
+	}
+	if len(w.errs) > 0 {
+		sort.Slice(w.errs, func(i, j int) bool {
+			return w.errs[i].path < w.errs[j].path
+		})
+		return w.errs
+	}
+	return nil
+}
+
+// print the entries of dir, listed already with subDirs the directories
+// among them; each directory is listed just before its own line goes out,
+// so a failure still lands on that line as a note
+func (w *walker) stream(out io.Writer, dir *dirFile, subDirs []dirJob, dirPrefix string, depth int) error {
+	jobs := make(map[*dirFile]dirJob, len(subDirs))
+	for _, job := range subDirs {
+		jobs[job.node] = job
+	}
+	files := dir.subDirFiles // alias
+	sortFiles(files, w.opts)
+
+	var lastIdx int
+	for idx, entry := range files {
+		if entry.isDir || w.opts.printFiles {
+			lastIdx = idx
+		}
+	}
+
+	for idx, entry := range files {
+		if !entry.isDir && !w.opts.printFiles {
+			continue
+		}
+		prefix, nextLevelPrefix := dirPrefix+"├───", dirPrefix+"│\t"
+		if idx == lastIdx {
+			prefix, nextLevelPrefix = dirPrefix+"└───", dirPrefix+"\t"
+		}
+
+		job, listed := jobs[entry]
+		var entrySubDirs []dirJob
+		if listed {
+			var err error
+			if entrySubDirs, err = w.readDir(job); err != nil {
+				return err
+			}
+		}
+		if _, err := fmt.Fprintln(out, prefix+entryLabel(entry, w.opts)); err != nil {
+			return err
+		}
+		if listed && (w.opts.maxDepth == 0 || depth < w.opts.maxDepth) {
+			if err := w.stream(out, entry, entrySubDirs, nextLevelPrefix, depth+1); err != nil {
+				return err
+			}
+		}
+		entry.subDirFiles = nil // printed
+	}
+	return nil
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"reflect"
+	"runtime"
+	"testing"
+	"testing/fstest"
+)
+
+func TestStreamMatchesTree(t *testing.T) {
+	fixture := makeFixture(t, 3, 4, 3)
+	variants := []options{
+		{},
+		{printFiles: true},
+		{printFiles: true, maxDepth: 2},
+		{printFiles: true, sortBy: sortByVersion, reverse: true, dirsFirst: true},
+		{printFiles: true, human: true, exclude: []string{"dir1", "file0.txt"}},
+		{printFiles: true, columns: columns{perms: true, date: true}},
+	}
+	for _, path := range []string{"testdata", fixture} {
+		for _, opts := range variants {
+			opts.format, opts.links = formatText, linksFollow
+			expected := treeString(t, path, opts)
+			opts.stream = true
+			if result := treeString(t, path, opts); result != expected {
+				t.Errorf("%s %+v: results not match\nGot:\n%v\nExpected:\n%v", path, opts, result, expected)
+			}
+		}
+	}
+}
+
+func TestStreamKeepGoing(t *testing.T) {
+	fsys := &faultyFS{
+		MapFS: fstest.MapFS{
+			"a/file.txt":      {Data: []byte("a")},
+			"locked/file.txt": {Data: []byte("b")},
+			"z/deep/locked/x": {Data: []byte("c")},
+			"z/deep/file.txt": {Data: []byte("d")},
+		},
+		broken: map[string]bool{"locked": true, "z/deep/locked": true},
+	}
+	for _, maxDepth := range []int{0, 1, 2} {
+		opts := options{printFiles: true, format: formatText, keepGoing: true, maxDepth: maxDepth}
+		expected := new(bytes.Buffer)
+		expectedErr := dirTreeFS(expected, fsys, opts)
+		opts.stream = true
+		result := new(bytes.Buffer)
+		err := dirTreeFS(result, fsys, opts)
+		if result.String() != expected.String() {
+			t.Errorf("-L %d: results not match\nGot:\n%v\nExpected:\n%v", maxDepth, result, expected)
+		}
+		// below the depth limit nothing is listed, so there is less to fail
+		if maxDepth == 0 && !reflect.DeepEqual(err, expectedErr) {
+			t.Errorf("-L %d: got error %v, expected %v", maxDepth, err, expectedErr)
+		}
+	}
+}
+
+func TestStreamConflicts(t *testing.T) {
+	for _, args := range [][]string{
+		{"--stream", "-J"},
+		{"--stream", "--du"},
+		{"--stream", "--sort", "size"},
+		{"--stream", "--stats"},
+		{"treediff", "--stream", "a", "b"},
+	} {
+		if code := run(args, io.Discard, io.Discard); code != exitUsage {
+			t.Errorf("%q: exit %d, expected %d", args, code, exitUsage)
+		}
+	}
+}
+
+// live heap after a GC, sampled every 64KiB of output
+type heapSampler struct {
+	unsampled int
+	peak      uint64
+}
+
+func (h *heapSampler) Write(p []byte) (int, error) {
+	if h.unsampled += len(p); h.unsampled >= 64<<10 {
+		h.unsampled = 0
+		var stats runtime.MemStats
+		runtime.GC()
+		runtime.ReadMemStats(&stats)
+		h.peak = max(h.peak, stats.HeapAlloc)
+	}
+	return len(p), nil
+}
+
+func benchmarkPrint(b *testing.B, stream bool) {
+	root := makeFixture(b, 4, 6, 8) // 1555 directories, 12440 files
+	opts := options{printFiles: true, format: formatText, links: linksFollow, stream: stream}
+	sampler := &heapSampler{}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := dirTreeWith(sampler, root, opts); err != nil {
+			b.Fatal(err)
+		}
+	}
+	b.ReportMetric(float64(sampler.peak), "peak-heap-B")
+}
+
+func BenchmarkPrintTree(b *testing.B)   { benchmarkPrint(b, false) }
+func BenchmarkPrintStream(b *testing.B) { benchmarkPrint(b, true) }
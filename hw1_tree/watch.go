@@ -0,0 +1,195 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"strings"
+	"time"
+)
+
+// quiet period before a burst of changes is re-printed
+const watchDebounce = 200 * time.Millisecond
+
+// a walked tree kept up to date entry by entry (watch mode)
+type liveTree struct {
+	w    *walker
+	root *dirFile
+}
+
+// what one update did to the tree
+type treeChange struct {
+	log     string   // "+ path", "- path", "~ path"; "" if nothing visible changed
+	watch   []string // directories that appeared
+	unwatch []string // directories that went away
+}
+
+func newLiveTree(src *source, opts options) (*liveTree, error) {
+	opts.keepGoing = true // errors are shown inline, a watch never stops
+	tree, err := walkSource(src, opts)
+	if tree == nil {
+		return nil, err
+	}
+	if !tree.isDir {
+		return nil, fmt.Errorf("%s: not a directory", src.label)
+	}
+	w, err := newWalker(src, opts)
+	if err != nil {
+		return nil, err
+	}
+	return &liveTree{w: w, root: tree}, nil
+}
+
+// every directory in the tree ("" is the root)
+func (t *liveTree) dirs() []string {
+	return subDirs(t.root, "")
+}
+
+func subDirs(dir *dirFile, rel string) []string {
+	rels := []string{rel}
+	for _, entry := range dir.subDirFiles {
+		if entry.isDir && !entry.linkOnly {
+			rels = append(rels, subDirs(entry, joinRel(rel, entry.name))...)
+		}
+	}
+	return rels
+}
+
+// the entry at rel, nil if it is not in the tree
+func (t *liveTree) lookup(rel string) *dirFile {
+	entry := t.root
+	for _, name := range splitName(path.Clean("./" + rel)) {
+		entry = findChild(entry, name)
+		if entry == nil {
+			return nil
+		}
+	}
+	return entry
+}
+
+func findChild(dir *dirFile, name string) *dirFile {
+	for _, entry := range dir.subDirFiles {
+		if entry.name == name {
+			return entry
+		}
+	}
+	return nil
+}
+
+// "a/b/c" -> "a/b", "c"
+func splitRel(rel string) (string, string) {
+	idx := strings.LastIndex(rel, "/")
+	if idx < 0 {
+		return "", rel
+	}
+	return rel[:idx], rel[idx+1:]
+}
+
+// the entry at rel was created or modified
+func (t *liveTree) update(rel string) treeChange {
+	defer t.w.clearErrs() // shown inline, not summed up
+	parentRel, name := splitRel(rel)
+	parent := t.lookup(parentRel)
+	if parent == nil || !parent.isDir || parent.linkOnly {
+		return treeChange{} // not (or no longer) part of the tree
+	}
+	info, err := fs.Lstat(t.w.src.fsys, t.w.fsName(rel))
+	if errors.Is(err, fs.ErrNotExist) {
+		return t.remove(rel) // gone again before we got to it
+	}
+	job, ignores := t.dirJob(parentRel, parent)
+	var entry *dirFile
+	var subDir *dirJob
+	if err != nil {
+		entry = &dirFile{name: name, notes: []string{errorLabel(err)}}
+	} else if entry, subDir, err = t.w.entry(job, fs.FileInfoToDirEntry(info), ignores); err != nil {
+		entry = &dirFile{name: name, notes: []string{errorLabel(err)}}
+	}
+	if entry == nil {
+		return t.remove(rel) // pruned
+	}
+
+	old := findChild(parent, name)
+	if old != nil && entryType(old) == entryType(entry) && old.linkTarget == entry.linkTarget {
+		// same kind of entry: refresh in place, directories keep their contents
+		modified := !old.isDir && (old.size != entry.size || !old.modTime.Equal(entry.modTime))
+		old.size, old.modTime, old.info, old.notes = entry.size, entry.modTime, entry.info, entry.notes
+		if modified {
+			return treeChange{log: "~ " + rel}
+		}
+		return treeChange{}
+	}
+
+	change := treeChange{log: "+ " + rel}
+	if old != nil {
+		change = t.remove(rel)
+		change.log = "~ " + rel
+	}
+	if subDir != nil {
+		t.w.walk(*subDir) // keep-going: errors end up on the entries
+		change.watch = subDirs(entry, rel)
+	}
+	parent.subDirFiles = append(parent.subDirFiles, entry)
+	return change
+}
+
+// the entry at rel was deleted or moved away
+func (t *liveTree) remove(rel string) treeChange {
+	parentRel, name := splitRel(rel)
+	parent := t.lookup(parentRel)
+	if parent == nil {
+		return treeChange{}
+	}
+	for idx, entry := range parent.subDirFiles {
+		if entry.name != name {
+			continue
+		}
+		parent.subDirFiles = append(parent.subDirFiles[:idx], parent.subDirFiles[idx+1:]...)
+		change := treeChange{log: "- " + rel}
+		if entry.isDir && !entry.linkOnly {
+			change.unwatch = subDirs(entry, rel)
+		}
+		return change
+	}
+	return treeChange{}
+}
+
+// the walk state of a directory in the tree, rebuilt from the root down:
+// the job listing it and the .gitignore rules for its entries
+func (t *liveTree) dirJob(rel string, node *dirFile) (dirJob, ignoreRules) {
+	w := t.w
+	job := dirJob{node: node, real: w.src.root}
+	if info, err := fs.Stat(w.src.fsys, w.src.root); err == nil {
+		job.ancestors = visit(nil, info, job.real)
+	}
+	for _, name := range splitName(path.Clean("./" + rel)) {
+		if w.opts.gitignore {
+			job.ignores, _ = job.ignores.load(w.src.fsys, w.fsName(job.rel), job.rel)
+		}
+		job.rel = joinRel(job.rel, name)
+		job.real, _ = realName(w.src.fsys, w.fsName(job.rel))
+		if info, err := fs.Stat(w.src.fsys, w.fsName(job.rel)); err == nil {
+			job.ancestors = visit(job.ancestors, info, job.real)
+		}
+	}
+	ignores := job.ignores
+	if w.opts.gitignore {
+		ignores, _ = ignores.load(w.src.fsys, w.fsName(rel), rel)
+	}
+	return job, ignores
+}
+
+// one frame of watch mode: the change log, then the whole tree
+func (t *liveTree) render(out io.Writer, log []string, opts options) error {
+	if len(log) > 0 {
+		fmt.Fprintf(out, "\n--- %s\n", time.Now().Format("15:04:05"))
+		for _, line := range log {
+			fmt.Fprintln(out, line)
+		}
+		fmt.Fprintln(out)
+	}
+	aggregate(t.root) // directory totals (du)
+	return writeTree(out, t.root, opts)
+}
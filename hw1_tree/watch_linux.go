@@ -0,0 +1,203 @@
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"syscall"
+	"time"
+)
+
+const watchMask = syscall.IN_CREATE | syscall.IN_DELETE | syscall.IN_MODIFY | syscall.IN_ATTRIB |
+	syscall.IN_MOVED_FROM | syscall.IN_MOVED_TO | syscall.IN_ONLYDIR
+
+// print the tree, then re-print it (with a change log) whenever inotify
+// reports something below path; runs until ctx is done
+func watchTree(ctx context.Context, out io.Writer, path string, opts options) error {
+	src, err := openSource(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	if src.osDir == "" || src.root != "." {
+		return fmt.Errorf("%s: only directories can be watched", path)
+	}
+	live, err := newLiveTree(src, opts)
+	if err != nil {
+		return err
+	}
+
+	ino, err := newInotify(src.osDir)
+	if err != nil {
+		return err
+	}
+	defer ino.close()
+	for _, rel := range live.dirs() {
+		ino.add(rel)
+	}
+	if err := live.render(out, nil, opts); err != nil {
+		return err
+	}
+
+	events := make(chan inotifyEvent)
+	readErr := make(chan error, 1)
+	go func() {
+		readErr <- ino.read(ctx, events)
+	}()
+
+	var log []string
+	timer := time.NewTimer(watchDebounce)
+	timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case err := <-readErr:
+			return err
+		case ev := <-events:
+			if ev.mask&syscall.IN_Q_OVERFLOW != 0 {
+				// events were lost: start over
+				if live, err = newLiveTree(src, opts); err != nil {
+					return err
+				}
+				ino.reset()
+				for _, rel := range live.dirs() {
+					ino.add(rel)
+				}
+				log = append(log, "! too many changes, walked again")
+				timer.Reset(watchDebounce)
+				continue
+			}
+			dir, ok := ino.wds[ev.wd]
+			if !ok || ev.name == "" {
+				continue // stale descriptor or event on the directory itself
+			}
+			rel := joinRel(dir, ev.name)
+			var change treeChange
+			if ev.mask&(syscall.IN_DELETE|syscall.IN_MOVED_FROM) != 0 {
+				change = live.remove(rel)
+			} else {
+				change = live.update(rel)
+			}
+			for _, rel := range change.unwatch {
+				ino.remove(rel)
+			}
+			for _, rel := range change.watch {
+				ino.add(rel)
+			}
+			if change.log != "" {
+				log = append(log, change.log)
+				timer.Reset(watchDebounce)
+			}
+		case <-timer.C:
+			sort.Strings(log)
+			if err := live.render(out, log, opts); err != nil {
+				return err
+			}
+			log = nil
+		}
+	}
+}
+
+// one raw event; name is relative to the directory watched by wd
+type inotifyEvent struct {
+	wd   int32
+	mask uint32
+	name string
+}
+
+type inotify struct {
+	fd   int
+	file *os.File // non-blocking reads through the runtime poller
+	root string
+	wds  map[int32]string // watch descriptor -> directory (event loop only)
+	rels map[string]int32
+}
+
+func newInotify(root string) (*inotify, error) {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		return nil, os.NewSyscallError("inotify_init1", err)
+	}
+	return &inotify{
+		fd:   fd,
+		file: os.NewFile(uintptr(fd), "inotify"),
+		root: root,
+		wds:  map[int32]string{},
+		rels: map[string]int32{},
+	}, nil
+}
+
+// directories may be gone already: errors are ignored
+func (ino *inotify) add(rel string) {
+	wd, err := syscall.InotifyAddWatch(ino.fd, filepath.Join(ino.root, filepath.FromSlash(rel)), watchMask)
+	if err != nil {
+		return
+	}
+	ino.wds[int32(wd)] = rel // moved directories keep their descriptor
+	ino.rels[rel] = int32(wd)
+}
+
+func (ino *inotify) remove(rel string) {
+	wd, ok := ino.rels[rel]
+	if !ok {
+		return
+	}
+	delete(ino.rels, rel)
+	if ino.wds[wd] == rel {
+		delete(ino.wds, wd)
+		syscall.InotifyRmWatch(ino.fd, uint32(wd))
+	}
+}
+
+func (ino *inotify) reset() {
+	for rel := range ino.rels {
+		ino.remove(rel)
+	}
+}
+
+func (ino *inotify) close() error {
+	return ino.file.Close()
+}
+
+// decode events until ctx is done or reading fails
+func (ino *inotify) read(ctx context.Context, events chan<- inotifyEvent) error {
+	go func() {
+		<-ctx.Done()
+		ino.file.SetReadDeadline(time.Now()) // unblock Read
+	}()
+	buf := make([]byte, 64<<10)
+	for {
+		n, err := ino.file.Read(buf)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		for off := 0; off+syscall.SizeofInotifyEvent <= n; {
+			wd := int32(binary.NativeEndian.Uint32(buf[off:]))
+			mask := binary.NativeEndian.Uint32(buf[off+4:])
+			size := int(binary.NativeEndian.Uint32(buf[off+12:]))
+			nameBytes := buf[off+syscall.SizeofInotifyEvent : off+syscall.SizeofInotifyEvent+size]
+			off += syscall.SizeofInotifyEvent + size
+
+			name := string(nameBytes)
+			for len(name) > 0 && name[len(name)-1] == 0 {
+				name = name[:len(name)-1] // NUL padding
+			}
+			if mask&syscall.IN_IGNORED != 0 {
+				continue // watch removed (directory deleted)
+			}
+			select {
+			case events <- inotifyEvent{wd: wd, mask: mask, name: name}:
+			case <-ctx.Done():
+				return nil
+			}
+		}
+	}
+}
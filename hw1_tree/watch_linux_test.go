@@ -0,0 +1,86 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// bytes.Buffer shared with the watching goroutine
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+// poll until the output contains every part
+func waitFor(t *testing.T, out *syncBuffer, parts ...string) {
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		result := out.String()
+		found := true
+		for _, part := range parts {
+			found = found && strings.Contains(result, part)
+		}
+		if found {
+			return
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	t.Fatalf("timed out waiting for %q\nGot:\n%v", parts, out.String())
+}
+
+func TestWatchTree(t *testing.T) {
+	root := makeTree(t, map[string]string{"build/app": "v1"})
+	ctx, cancel := context.WithCancel(context.Background())
+	out := &syncBuffer{}
+	done := make(chan error, 1)
+	go func() {
+		done <- watchTree(ctx, out, root, options{printFiles: true, format: formatText})
+	}()
+	waitFor(t, out, "└───build\n\t└───app (2b)\n")
+
+	// a directory created mid-watch is watched as well
+	if err := os.Mkdir(filepath.Join(root, "build", "debug"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, out, "+ build/debug\n")
+	if err := os.WriteFile(filepath.Join(root, "build", "debug", "app.sym"), []byte("sym"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, out, "+ build/debug/app.sym\n", "\t└───debug\n\t\t└───app.sym (3b)\n")
+
+	if err := os.RemoveAll(filepath.Join(root, "build", "debug")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "build", "app"), []byte("v2-bigger"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, out, "- build/debug\n", "~ build/app\n", "└───build\n\t└───app (9b)\n")
+
+	cancel()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("watch did not stop")
+	}
+}
@@ -0,0 +1,14 @@
+//go:build !linux
+
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+)
+
+// watch mode is built on inotify
+func watchTree(ctx context.Context, out io.Writer, path string, opts options) error {
+	return errors.New("watch mode is only available on linux")
+}
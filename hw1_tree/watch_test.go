@@ -0,0 +1,126 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestLiveTree(t *testing.T) {
+	root := makeTree(t, map[string]string{
+		"build/app":   "v1",
+		"build/old":   "old",
+		"src/main.go": "package main",
+	})
+	src, err := openSource(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := options{printFiles: true, format: formatText, exclude: []string{"*.tmp"}}
+	live, err := newLiveTree(src, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	write := func(name, content string) {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("build/app", "v2-bigger")
+	write("build/debug/app.sym", "sym")
+	write("build/scratch.tmp", "x")
+	if err := os.Remove(filepath.Join(root, "build", "old")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.RemoveAll(filepath.Join(root, "src")); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		update bool
+		rel    string
+		change treeChange
+	}{
+		{true, "build/app", treeChange{log: "~ build/app"}},
+		{true, "build/debug", treeChange{log: "+ build/debug", watch: []string{"build/debug"}}},
+		{true, "build/debug/app.sym", treeChange{}}, // walked with its directory
+		{true, "build/scratch.tmp", treeChange{}},   // pruned
+		{true, "build/old", treeChange{log: "- build/old"}},
+		{false, "src", treeChange{log: "- src", unwatch: []string{"src"}}},
+		{false, "src/main.go", treeChange{}}, // with its directory
+		{true, "nowhere/file", treeChange{}}, // not in the tree
+	}
+	for _, c := range cases {
+		var change treeChange
+		if c.update {
+			change = live.update(c.rel)
+		} else {
+			change = live.remove(c.rel)
+		}
+		if !reflect.DeepEqual(change, c.change) {
+			t.Errorf("%s: got %+v, expected %+v", c.rel, change, c.change)
+		}
+	}
+
+	out := new(bytes.Buffer)
+	if err := live.render(out, nil, opts); err != nil {
+		t.Fatal(err)
+	}
+	expected := `└───build
+	├───app (9b)
+	└───debug
+		└───app.sym (3b)
+`
+	if result := out.String(); result != expected {
+		t.Errorf("results not match\nGot:\n%v\nExpected:\n%v", result, expected)
+	}
+	if dirs := live.dirs(); !reflect.DeepEqual(dirs, []string{"", "build", "build/debug"}) {
+		t.Errorf("unexpected directories %v", dirs)
+	}
+}
+
+// failed updates are shown inline, the watch does not pile them up
+func TestLiveTreeErrors(t *testing.T) {
+	if os.Geteuid() == 0 {
+		t.Skip("root can open any directory")
+	}
+	root := makeTree(t, map[string]string{"a/file.txt": "a"})
+	src, err := openSource(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := options{printFiles: true, format: formatText}
+	live, err := newLiveTree(src, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	locked := filepath.Join(root, "locked")
+	if err := os.Mkdir(locked, 0); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chmod(locked, 0755)
+	live.update("locked")
+	if len(live.w.errs) != 0 {
+		t.Errorf("expected no errors kept, got %v", live.w.errs)
+	}
+
+	out := new(bytes.Buffer)
+	if err := live.render(out, nil, opts); err != nil {
+		t.Fatal(err)
+	}
+	expected := `├───a
+│	└───file.txt (1b)
+└───locked [permission denied]
+`
+	if result := out.String(); result != expected {
+		t.Errorf("results not match\nGot:\n%v\nExpected:\n%v", result, expected)
+	}
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// jobs made of jobs, for flows that are not a straight line. Every channel
+// made here is closed once nothing sends on it any more, and the jobs given
+// get their input drained after they return, as in ExecutePipeline.
+
+// FanOut runs n copies of dataJob side by side; see Merge
+func FanOut(n int, dataJob job) job {
+	jobs := make([]job, n)
+	for i := range jobs {
+		jobs[i] = dataJob
+	}
+	return Merge(jobs...)
+}
+
+// Merge runs the jobs side by side: every value of in goes to the one of them
+// taking it first, everything they send goes to out. Jobs that do not read
+// in are several sources merged into one.
+func Merge(jobs ...job) job {
+	return func(in, out chan interface{}) {
+		wg := &sync.WaitGroup{}
+		wg.Add(len(jobs)) // +
+		for _, dataJob := range jobs {
+			go func(dataJob job) {
+				defer wg.Done() // -1
+				dataJob(in, out)
+			}(dataJob)
+		}
+		wg.Wait()
+	}
+}
+
+// Filter hands on the values keep returns true for
+func Filter(keep func(interface{}) bool) job {
+	return func(in, out chan interface{}) {
+		for val := range in {
+			if keep(val) {
+				out <- val
+			}
+		}
+	}
+}
+
+// Batch sends the values in []interface{} batches of size values, or of what
+// came within window after the first one of the batch; size < 1 or window 0
+// leave that limit out. What is left is sent once in is closed.
+func Batch(size int, window time.Duration) job {
+	return func(in, out chan interface{}) {
+		var batch []interface{}
+		var timer *time.Timer
+		var timeout <-chan time.Time // nil while no batch is open
+		flush := func() {
+			if timer != nil {
+				timer.Stop()
+				timer, timeout = nil, nil
+			}
+			if len(batch) > 0 {
+				out <- batch
+				batch = nil
+			}
+		}
+
+		for {
+			select {
+			case val, ok := <-in:
+				if !ok {
+					flush()
+					return
+				}
+				batch = append(batch, val)
+				if len(batch) == 1 && window > 0 {
+					timer = time.NewTimer(window)
+					timeout = timer.C
+				}
+				if size > 0 && len(batch) >= size {
+					flush()
+				}
+			case <-timeout:
+				flush()
+			}
+		}
+	}
+}
+
+// Tee hands every value to each of the sinks, in turn: a slow one holds the
+// others back. What they send goes to out.
+func Tee(sinks ...job) job {
+	return func(in, out chan interface{}) {
+		wg := &sync.WaitGroup{}
+		wg.Add(len(sinks)) // +
+		chans := make([]chan interface{}, len(sinks))
+		for idx, sink := range sinks {
+			chans[idx] = make(chan interface{})
+			go func(sink job, ch chan interface{}) {
+				defer wg.Done() // -1
+				sink(ch, out)
+				for range ch { // a sink done early gets no more
+				}
+			}(sink, chans[idx])
+		}
+
+		for val := range in {
+			for _, ch := range chans {
+				ch <- val
+			}
+		}
+		for _, ch := range chans {
+			close(ch)
+		}
+		wg.Wait()
+	}
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+// what the last job got, in order
+func collect(result *[]interface{}) job {
+	return func(in, out chan interface{}) {
+		for val := range in {
+			*result = append(*result, val)
+		}
+	}
+}
+
+func numbers(nums ...int) job {
+	return func(in, out chan interface{}) {
+		for _, num := range nums {
+			out <- num
+		}
+	}
+}
+
+func sortedInts(vals []interface{}) []int {
+	var nums []int
+	for _, val := range vals {
+		nums = append(nums, val.(int))
+	}
+	sort.Ints(nums)
+	return nums
+}
+
+func TestFanOut(t *testing.T) {
+	var result []interface{}
+	start := time.Now()
+	ExecutePipeline(
+		numbers(1, 2, 3, 4, 5, 6, 7, 8),
+		FanOut(4, func(in, out chan interface{}) {
+			for val := range in {
+				time.Sleep(100 * time.Millisecond)
+				out <- val.(int) * 2
+			}
+		}),
+		collect(&result),
+	)
+	end := time.Since(start)
+
+	expected := []int{2, 4, 6, 8, 10, 12, 14, 16}
+	if got := sortedInts(result); !reflect.DeepEqual(got, expected) {
+		t.Errorf("results not match\nGot: %v\nExpected: %v", got, expected)
+	}
+	if expectedTime := 350 * time.Millisecond; end > expectedTime {
+		t.Errorf("execition too long\nGot: %s\nExpected: <%s", end, expectedTime)
+	}
+}
+
+func TestMerge(t *testing.T) {
+	var result []interface{}
+	ExecutePipeline(
+		Merge(numbers(1, 3, 5), numbers(2, 4)),
+		collect(&result),
+	)
+	expected := []int{1, 2, 3, 4, 5}
+	if got := sortedInts(result); !reflect.DeepEqual(got, expected) {
+		t.Errorf("results not match\nGot: %v\nExpected: %v", got, expected)
+	}
+}
+
+func TestFilter(t *testing.T) {
+	var result []interface{}
+	ExecutePipeline(
+		numbers(1, 2, 3, 4, 5, 6),
+		Filter(func(val interface{}) bool { return val.(int)%2 == 0 }),
+		collect(&result),
+	)
+	expected := []interface{}{2, 4, 6}
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("results not match\nGot: %v\nExpected: %v", result, expected)
+	}
+}
+
+func TestBatch(t *testing.T) {
+	var result []interface{}
+	ExecutePipeline(
+		numbers(1, 2, 3, 4, 5, 6, 7),
+		Batch(3, 0),
+		collect(&result),
+	)
+	expected := []interface{}{
+		[]interface{}{1, 2, 3},
+		[]interface{}{4, 5, 6},
+		[]interface{}{7},
+	}
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("results not match\nGot: %v\nExpected: %v", result, expected)
+	}
+
+	result = nil
+	ExecutePipeline(
+		func(in, out chan interface{}) {
+			out <- 1
+			out <- 2
+			time.Sleep(100 * time.Millisecond) // the window closes
+			out <- 3
+			out <- 4
+			out <- 5
+		},
+		Batch(2, 30*time.Millisecond),
+		collect(&result),
+	)
+	expected = []interface{}{
+		[]interface{}{1, 2},
+		[]interface{}{3, 4},
+		[]interface{}{5},
+	}
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("results not match\nGot: %v\nExpected: %v", result, expected)
+	}
+
+	result = nil
+	ExecutePipeline(
+		func(in, out chan interface{}) {
+			out <- 1
+			time.Sleep(100 * time.Millisecond)
+			out <- 2
+		},
+		Batch(0, 30*time.Millisecond),
+		collect(&result),
+	)
+	expected = []interface{}{[]interface{}{1}, []interface{}{2}}
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("results not match\nGot: %v\nExpected: %v", result, expected)
+	}
+}
+
+func TestTee(t *testing.T) {
+	var result []interface{}
+	ExecutePipeline(
+		numbers(1, 2, 3),
+		Tee(
+			func(in, out chan interface{}) { // sum
+				sum := 0
+				for val := range in {
+					sum += val.(int)
+				}
+				out <- sum
+			},
+			func(in, out chan interface{}) { // only the first one
+				out <- (<-in).(int) * 100
+			},
+			func(in, out chan interface{}) { // squares
+				for val := range in {
+					out <- val.(int) * val.(int)
+				}
+			},
+		),
+		collect(&result),
+	)
+	expected := []int{1, 4, 6, 9, 100}
+	if got := sortedInts(result); !reflect.DeepEqual(got, expected) {
+		t.Errorf("results not match\nGot: %v\nExpected: %v", got, expected)
+	}
+}
@@ -0,0 +1,379 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// the nodes every graph has: what the graph job reads comes out of
+// GraphInput's "out" port, what goes into GraphOutput's "in" port is what the
+// graph job sends. A graph does not need to use them.
+const (
+	GraphInput  = "input"
+	GraphOutput = "output"
+)
+
+// a node of a Graph: it reads its input ports until they are closed and
+// sends on its output ports, by name
+type NodeFunc func(in, out map[string]chan interface{})
+
+// Graph is a pipeline that is not a straight line: nodes with named ports,
+// edges from output ports to input ports. An output port with several edges
+// hands every value to each of them, queueing it for the edges whose node
+// does not take it yet: a node may read its ports in any order, and one
+// lagging behind holds the values in memory. An input port with several edges
+// gets the values of all of them.
+//
+// It runs like ExecutePipeline: a goroutine per node, unbuffered channels,
+// every channel closed once all that send on it have returned.
+type Graph struct {
+	nodes  []*graphNode // as declared
+	byName map[string]*graphNode
+	edges  []graphEdge
+}
+
+type graphNode struct {
+	name      string
+	ins, outs []string
+	fn        NodeFunc
+}
+
+type graphEdge struct {
+	from, fromPort string
+	to, toPort     string
+}
+
+func NewGraph() *Graph {
+	g := &Graph{byName: make(map[string]*graphNode)}
+	g.add(&graphNode{name: GraphInput, outs: []string{"out"}})
+	g.add(&graphNode{name: GraphOutput, ins: []string{"in"}})
+	return g
+}
+
+// AddNode declares a node with its input and output ports
+func (g *Graph) AddNode(name string, ins, outs []string, fn NodeFunc) error {
+	switch {
+	case name == "":
+		return errors.New("graph: a node needs a name")
+	case fn == nil:
+		return fmt.Errorf("graph: node %q does nothing", name)
+	case g.byName[name] != nil:
+		return fmt.Errorf("graph: node %q declared twice", name)
+	}
+	seen := make(map[string]bool)
+	for _, port := range append(append([]string{}, ins...), outs...) {
+		if seen[port] {
+			return fmt.Errorf("graph: node %q: port %q declared twice", name, port)
+		}
+		seen[port] = true
+	}
+	g.add(&graphNode{name: name, ins: ins, outs: outs, fn: fn})
+	return nil
+}
+
+func (g *Graph) add(node *graphNode) {
+	g.nodes = append(g.nodes, node)
+	g.byName[node.name] = node
+}
+
+// AddJob declares a node running dataJob, with an input port "in" and an
+// output port "out"
+func (g *Graph) AddJob(name string, dataJob job) error {
+	return g.AddNode(name, []string{"in"}, []string{"out"}, func(in, out map[string]chan interface{}) {
+		dataJob(in["in"], out["out"])
+	})
+}
+
+// Connect adds an edge from the output port fromPort of node from to the input
+// port toPort of node to
+func (g *Graph) Connect(from, fromPort, to, toPort string) error {
+	switch {
+	case g.byName[from] == nil:
+		return fmt.Errorf("graph: no node %q", from)
+	case g.byName[to] == nil:
+		return fmt.Errorf("graph: no node %q", to)
+	case !hasPort(g.byName[from].outs, fromPort):
+		return fmt.Errorf("graph: node %q has no output %q", from, fromPort)
+	case !hasPort(g.byName[to].ins, toPort):
+		return fmt.Errorf("graph: node %q has no input %q", to, toPort)
+	}
+	edge := graphEdge{from: from, fromPort: fromPort, to: to, toPort: toPort}
+	for _, known := range g.edges {
+		if known == edge {
+			return fmt.Errorf("graph: %s.%s -> %s.%s connected twice", from, fromPort, to, toPort)
+		}
+	}
+	g.edges = append(g.edges, edge)
+	return nil
+}
+
+func hasPort(ports []string, port string) bool {
+	for _, known := range ports {
+		if known == port {
+			return true
+		}
+	}
+	return false
+}
+
+// Check reports the first port without an edge (but those of GraphInput and
+// GraphOutput) and the first cycle
+func (g *Graph) Check() error {
+	connected := make(map[string]bool) // "node\x00port"
+	for _, edge := range g.edges {
+		connected[edge.from+"\x00"+edge.fromPort] = true
+		connected[edge.to+"\x00"+edge.toPort] = true
+	}
+	for _, node := range g.nodes {
+		if node.name == GraphInput || node.name == GraphOutput {
+			continue
+		}
+		for _, port := range node.ins {
+			if !connected[node.name+"\x00"+port] {
+				return fmt.Errorf("graph: node %q: input %q is not connected", node.name, port)
+			}
+		}
+		for _, port := range node.outs {
+			if !connected[node.name+"\x00"+port] {
+				return fmt.Errorf("graph: node %q: output %q is not connected", node.name, port)
+			}
+		}
+	}
+
+	// depth first; a node met again while still on the path closes a cycle
+	const (
+		unseen = iota
+		onPath
+		done
+	)
+	state := make(map[string]int)
+	var path []string
+	var visit func(name string) error
+	visit = func(name string) error {
+		state[name] = onPath
+		path = append(path, name)
+		for _, edge := range g.edges {
+			if edge.from != name {
+				continue
+			}
+			switch state[edge.to] {
+			case onPath:
+				start := 0
+				for path[start] != edge.to {
+					start++
+				}
+				cycle := append(append([]string{}, path[start:]...), edge.to)
+				return fmt.Errorf("graph: cycle %s", strings.Join(cycle, " -> "))
+			case unseen:
+				if err := visit(edge.to); err != nil {
+					return err
+				}
+			}
+		}
+		path = path[:len(path)-1]
+		state[name] = done
+		return nil
+	}
+	for _, node := range g.nodes {
+		if state[node.name] == unseen {
+			if err := visit(node.name); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Job checks the graph and returns a job running it
+func (g *Graph) Job() (job, error) {
+	if err := g.Check(); err != nil {
+		return nil, err
+	}
+	return g.run, nil
+}
+
+func (g *Graph) run(in, out chan interface{}) {
+	ports := make(map[string]chan interface{}) // "node\x00port"
+	senders := make(map[chan interface{}]int)  // edges into an input port
+	for _, node := range g.nodes {
+		for _, port := range append(append([]string{}, node.ins...), node.outs...) {
+			ports[node.name+"\x00"+port] = make(chan interface{})
+		}
+	}
+	ports[GraphInput+"\x00out"] = in  // closed before the job
+	ports[GraphOutput+"\x00in"] = out // closed after the job
+	for _, edge := range g.edges {
+		senders[ports[edge.to+"\x00"+edge.toPort]]++
+	}
+
+	mu := &sync.Mutex{}
+	closeInput := func(ch chan interface{}) {
+		mu.Lock()
+		defer mu.Unlock()
+		if senders[ch]--; senders[ch] == 0 && ch != out {
+			close(ch)
+		}
+	}
+
+	wg := &sync.WaitGroup{}
+	for _, node := range g.nodes {
+		// an output port hands each value on along its edges
+		for _, port := range node.outs {
+			var targets []chan interface{}
+			for _, edge := range g.edges {
+				if edge.from == node.name && edge.fromPort == port {
+					targets = append(targets, ports[edge.to+"\x00"+edge.toPort])
+				}
+			}
+			if node.name == GraphInput && len(targets) == 0 {
+				continue // the input is not read: ExecutePipeline drains it
+			}
+			edges, queued := targets, len(targets) > 1
+			if queued {
+				// several edges: each gets a queue, so that none waits for another
+				edges = make([]chan interface{}, len(targets))
+				for idx, target := range targets {
+					edges[idx] = make(chan interface{})
+					wg.Add(1) // +1
+					go func(edge, target chan interface{}) {
+						defer wg.Done() // -1
+						queue(edge, target)
+						closeInput(target)
+					}(edges[idx], target)
+				}
+			}
+			wg.Add(1) // +1
+			go func(src chan interface{}, edges []chan interface{}, queued bool) {
+				defer wg.Done() // -1
+				for val := range src {
+					for _, edge := range edges {
+						edge <- val
+					}
+				}
+				for _, edge := range edges {
+					if queued {
+						close(edge) // the queue closes the target
+					} else {
+						closeInput(edge)
+					}
+				}
+			}(ports[node.name+"\x00"+port], edges, queued)
+		}
+
+		if node.fn == nil {
+			continue // GraphInput, GraphOutput
+		}
+		ins := make(map[string]chan interface{})
+		for _, port := range node.ins {
+			ins[port] = ports[node.name+"\x00"+port]
+		}
+		outs := make(map[string]chan interface{})
+		for _, port := range node.outs {
+			outs[port] = ports[node.name+"\x00"+port]
+		}
+		wg.Add(1) // +1
+		go func(node *graphNode) {
+			defer wg.Done() // -1
+			node.fn(ins, outs)
+			for _, ch := range outs {
+				close(ch)
+			}
+			// a node done early gets no more, on any port at once: one edge
+			// may feed several of them
+			drain := &sync.WaitGroup{}
+			drain.Add(len(ins))
+			for _, ch := range ins {
+				go func(ch chan interface{}) {
+					defer drain.Done()
+					for range ch {
+					}
+				}(ch)
+			}
+			drain.Wait()
+		}(node)
+	}
+	wg.Wait()
+}
+
+// hand on what comes from in to out, in order, keeping what out does not take
+// yet: in is never held up
+func queue(in, out chan interface{}) {
+	var pending []interface{}
+	for in != nil || len(pending) > 0 {
+		var next chan interface{} // nil, never ready, while nothing is pending
+		var val interface{}
+		if len(pending) > 0 {
+			next, val = out, pending[0]
+		}
+		select {
+		case got, ok := <-in:
+			if !ok {
+				in = nil
+				continue
+			}
+			pending = append(pending, got)
+		case next <- val:
+			pending[0] = nil
+			pending = pending[1:]
+		}
+	}
+}
+
+// ---
+
+// signerJob signs every string on up to MaxInputDataLen goroutines, keeping
+// their order, so that branches of the same values can be joined again
+func signerJob(signer func(string) string) job {
+	return stageJob(Erase(OrderedMap(0, MaxInputDataLen, func(_ context.Context, data string) (string, error) {
+		return sign(signer, data)
+	})))
+}
+
+// Crc32Job is the CRC32 branch of SingleHash as a reusable job
+func Crc32Job() job {
+	return signerJob(func(data string) string { return DataSignerCrc32(data) })
+}
+
+// Md5Job is the MD5 branch of SingleHash as a reusable job
+func Md5Job() job {
+	return signerJob(DataSignerMd5Proxy)
+}
+
+// SingleHashGraph is SingleHash as a graph of its branches:
+//
+//	input -> data -> crc32 ---------------> join -> output
+//	             \-> md5 -> crc32(md5) ----/
+func SingleHashGraph() (job, error) {
+	g := NewGraph()
+	errs := []error{
+		g.AddJob("data", func(in, out chan interface{}) {
+			for val := range in {
+				out <- strconv.Itoa(val.(int)) // interface (int) -> int -> string
+			}
+		}),
+		g.AddJob("crc32", Crc32Job()),
+		g.AddJob("md5", Md5Job()),
+		g.AddJob("crc32(md5)", Crc32Job()),
+		g.AddNode("join", []string{"left", "right"}, []string{"out"}, func(in, out map[string]chan interface{}) {
+			for left := range in["left"] {
+				right := <-in["right"]
+				out["out"] <- left.(string) + "~" + right.(string)
+			}
+		}),
+		g.Connect(GraphInput, "out", "data", "in"),
+		g.Connect("data", "out", "crc32", "in"),
+		g.Connect("data", "out", "md5", "in"),
+		g.Connect("md5", "out", "crc32(md5)", "in"),
+		g.Connect("crc32", "out", "join", "left"),
+		g.Connect("crc32(md5)", "out", "join", "right"),
+		g.Connect("join", "out", GraphOutput, "in"),
+	}
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+	return g.Job()
+}
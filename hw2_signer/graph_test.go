@@ -0,0 +1,229 @@
+package main
+
+import (
+	"reflect"
+	"runtime"
+	"testing"
+	"time"
+)
+
+// a job of f for every int value
+func mapInts(f func(int) int) job {
+	return func(in, out chan interface{}) {
+		for val := range in {
+			out <- f(val.(int))
+		}
+	}
+}
+
+func TestGraphDiamond(t *testing.T) {
+	before := runtime.NumGoroutine()
+	g := NewGraph()
+	errs := []error{
+		g.AddJob("double", mapInts(func(num int) int { return num * 2 })),
+		g.AddJob("square", mapInts(func(num int) int { return num * num })),
+		// reads one value and is done: the rest is drained
+		g.AddNode("first", []string{"in"}, nil, func(in, out map[string]chan interface{}) {
+			<-in["in"]
+		}),
+		g.AddNode("sum", []string{"a", "b"}, []string{"out"}, func(in, out map[string]chan interface{}) {
+			for a := range in["a"] {
+				b := <-in["b"]
+				out["out"] <- a.(int) + b.(int)
+			}
+		}),
+		g.Connect(GraphInput, "out", "double", "in"),
+		g.Connect(GraphInput, "out", "square", "in"),
+		g.Connect(GraphInput, "out", "first", "in"),
+		g.Connect("double", "out", "sum", "a"),
+		g.Connect("square", "out", "sum", "b"),
+		g.Connect("sum", "out", GraphOutput, "in"),
+	}
+	for _, err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	graphJob, err := g.Job()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var result []interface{}
+	ExecutePipeline(numbers(1, 2, 3), graphJob, collect(&result))
+	expected := []interface{}{3, 8, 15}
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("results not match\nGot: %v\nExpected: %v", result, expected)
+	}
+	checkGoroutines(t, before)
+}
+
+// sources merged into one input port, no GraphInput
+func TestGraphMerge(t *testing.T) {
+	g := NewGraph()
+	errs := []error{
+		g.AddNode("odd", nil, []string{"out"}, func(in, out map[string]chan interface{}) {
+			out["out"] <- 1
+			out["out"] <- 3
+		}),
+		g.AddNode("even", nil, []string{"out"}, func(in, out map[string]chan interface{}) {
+			out["out"] <- 2
+		}),
+		g.AddJob("inc", mapInts(func(num int) int { return num + 1 })),
+		g.Connect("odd", "out", "inc", "in"),
+		g.Connect("even", "out", "inc", "in"),
+		g.Connect("inc", "out", GraphOutput, "in"),
+	}
+	for _, err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	graphJob, err := g.Job()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var result []interface{}
+	ExecutePipeline(graphJob, collect(&result))
+	expected := []int{2, 3, 4}
+	if got := sortedInts(result); !reflect.DeepEqual(got, expected) {
+		t.Errorf("results not match\nGot: %v\nExpected: %v", got, expected)
+	}
+}
+
+// one output port feeding two inputs of a node that reads them the other
+// way round, or one of them to the end first
+func TestGraphFanOutOrder(t *testing.T) {
+	before := runtime.NumGoroutine()
+	cases := []struct {
+		name     string
+		fn       NodeFunc
+		expected []interface{}
+	}{
+		{"b before a", func(in, out map[string]chan interface{}) {
+			for b := range in["b"] {
+				a := <-in["a"]
+				out["out"] <- a.(int)*10 + b.(int)
+			}
+		}, []interface{}{11, 22, 33, 44}},
+		{"all of a first", func(in, out map[string]chan interface{}) {
+			sum := 0
+			for a := range in["a"] {
+				sum += a.(int)
+			}
+			for b := range in["b"] {
+				sum += b.(int) * 10
+			}
+			out["out"] <- sum
+		}, []interface{}{110}},
+	}
+	for _, tc := range cases {
+		g := NewGraph()
+		errs := []error{
+			g.AddNode("pair", []string{"a", "b"}, []string{"out"}, tc.fn),
+			g.Connect(GraphInput, "out", "pair", "a"),
+			g.Connect(GraphInput, "out", "pair", "b"),
+			g.Connect("pair", "out", GraphOutput, "in"),
+		}
+		for _, err := range errs {
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		graphJob, err := g.Job()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var result []interface{}
+		ExecutePipeline(numbers(1, 2, 3, 4), graphJob, collect(&result))
+		if !reflect.DeepEqual(result, tc.expected) {
+			t.Errorf("%s: results not match\nGot: %v\nExpected: %v", tc.name, result, tc.expected)
+		}
+	}
+	checkGoroutines(t, before)
+}
+
+func TestGraphCheck(t *testing.T) {
+	noop := func(in, out chan interface{}) {}
+	cases := []struct {
+		name     string
+		build    func(g *Graph) error
+		expected string
+	}{
+		{"duplicate node", func(g *Graph) error {
+			g.AddJob("a", noop)
+			return g.AddJob("a", noop)
+		}, `graph: node "a" declared twice`},
+		{"no func", func(g *Graph) error {
+			return g.AddNode("a", nil, nil, nil)
+		}, `graph: node "a" does nothing`},
+		{"reserved name", func(g *Graph) error {
+			return g.AddJob(GraphInput, noop)
+		}, `graph: node "input" declared twice`},
+		{"unknown node", func(g *Graph) error {
+			g.AddJob("a", noop)
+			return g.Connect("a", "out", "b", "in")
+		}, `graph: no node "b"`},
+		{"unknown port", func(g *Graph) error {
+			g.AddJob("a", noop)
+			g.AddJob("b", noop)
+			return g.Connect("a", "in", "b", "in")
+		}, `graph: node "a" has no output "in"`},
+		{"unconnected input", func(g *Graph) error {
+			g.AddJob("a", noop)
+			g.Connect("a", "out", GraphOutput, "in")
+			return g.Check()
+		}, `graph: node "a": input "in" is not connected`},
+		{"unconnected output", func(g *Graph) error {
+			g.AddJob("a", noop)
+			g.Connect(GraphInput, "out", "a", "in")
+			return g.Check()
+		}, `graph: node "a": output "out" is not connected`},
+		{"cycle", func(g *Graph) error {
+			g.AddJob("a", noop)
+			g.AddNode("b", []string{"in", "loop"}, []string{"out"}, func(in, out map[string]chan interface{}) {})
+			g.AddJob("c", noop)
+			g.Connect(GraphInput, "out", "b", "in")
+			g.Connect("a", "out", "b", "loop")
+			g.Connect("b", "out", "c", "in")
+			g.Connect("c", "out", "a", "in")
+			return g.Check()
+		}, `graph: cycle b -> c -> a -> b`},
+	}
+	for _, tc := range cases {
+		err := tc.build(NewGraph())
+		if err == nil || err.Error() != tc.expected {
+			t.Errorf("%s: results not match\nGot: %v\nExpected: %v", tc.name, err, tc.expected)
+		}
+	}
+}
+
+// the SingleHash branches as nodes give what SingleHash does
+func TestGraphSingleHash(t *testing.T) {
+	singleHash, err := SingleHashGraph()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var result interface{}
+	start := time.Now()
+	ExecutePipeline(
+		numbers(0, 1, 1, 2, 3, 5, 8),
+		singleHash,
+		job(MultiHash),
+		job(CombineResults),
+		func(in, out chan interface{}) {
+			result = <-in
+		},
+	)
+	end := time.Since(start)
+
+	expected := "1173136728138862632818075107442090076184424490584241521304_1696913515191343735512658979631549563179965036907783101867_27225454331033649287118297354036464389062965355426795162684_29568666068035183841425683795340791879727309630931025356555_3994492081516972096677631278379039212655368881548151736_4958044192186797981418233587017209679042592862002427381542_4958044192186797981418233587017209679042592862002427381542"
+	if result != expected {
+		t.Errorf("results not match\nGot: %v\nExpected: %v", result, expected)
+	}
+	if expectedTime := 3 * time.Second; end > expectedTime {
+		t.Errorf("execition too long\nGot: %s\nExpected: <%s", end, expectedTime)
+	}
+}
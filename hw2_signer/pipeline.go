@@ -0,0 +1,338 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// Stage is one typed step of a pipeline: it reads In values until in is
+// closed or ctx is done and sends Out values. It does not close out; whoever
+// runs it does, and drains in after it returns. An error (or a panic) cancels
+// the stages around it.
+//
+// Stages are linked with Then, so the element types of every channel are
+// checked by the compiler from the first stage to the last:
+//
+//	Then(Then(Values(0, 1, 1), SingleHashStage), MultiHashStage)
+type Stage[In, Out any] func(ctx context.Context, in chan In, out chan Out) error
+
+// Then runs first and next concurrently, first feeding next. The first error
+// of either cancels both; it is returned once both have returned.
+func Then[A, B, C any](first Stage[A, B], next Stage[B, C]) Stage[A, C] {
+	return func(ctx context.Context, in chan A, out chan C) error {
+		ctx, cancel := context.WithCancelCause(ctx)
+		defer cancel(nil)
+
+		var once sync.Once
+		var firstErr error
+		fail := func(err error) {
+			if err != nil {
+				once.Do(func() {
+					firstErr = err
+					cancel(err)
+				})
+			}
+		}
+
+		mid := make(chan B)
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			fail(runStage(ctx, first, in, mid))
+			close(mid)
+		}()
+
+		fail(runStage(ctx, next, mid, out))
+		// first may still be sending: let it run into ctx or the end of in
+		for range mid {
+		}
+		<-done
+		return firstErr
+	}
+}
+
+// Run runs stage with a closed input and drops what it sends. It returns the
+// first error of the stage, or why ctx ended if it did.
+func Run[In, Out any](ctx context.Context, stage Stage[In, Out]) error {
+	return run(ctx, stage, func(Out) {})
+}
+
+// Collect runs stage like Run and returns what it sent, in order
+func Collect[Out any](ctx context.Context, stage Stage[struct{}, Out]) ([]Out, error) {
+	var vals []Out
+	err := run(ctx, stage, func(val Out) {
+		vals = append(vals, val)
+	})
+	return vals, err
+}
+
+// Values is a first stage sending vals
+func Values[T any](vals ...T) Stage[struct{}, T] {
+	return func(ctx context.Context, _ chan struct{}, out chan T) error {
+		for _, val := range vals {
+			if err := send(ctx, out, val); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// ParallelMap is a stage sending f of every value, computed on up to workers
+// goroutines (one per value if workers < 1). Up to buffer results wait for
+// the next stage; once they and every worker do, in is not read any more and
+// the stages before are held back. Results come in the order they are done.
+func ParallelMap[In, Out any](workers, buffer int, f func(context.Context, In) (Out, error)) Stage[In, Out] {
+	return func(ctx context.Context, in chan In, out chan Out) error {
+		g, workCtx := newErrGroup(ctx)
+		results := make(chan Out, buffer)
+		work := func(val In) error {
+			res, err := f(workCtx, val)
+			if err != nil {
+				return err
+			}
+			return send(workCtx, results, res)
+		}
+
+		var err error
+		go func() {
+			if workers < 1 {
+				for {
+					val, ok := receive(workCtx, in)
+					if !ok {
+						break
+					}
+					g.Go(func() error { return work(val) })
+				}
+			} else {
+				for i := 0; i < workers; i++ {
+					g.Go(func() error {
+						for {
+							val, ok := receive(workCtx, in)
+							if !ok {
+								return nil
+							}
+							if err := work(val); err != nil {
+								return err
+							}
+						}
+					})
+				}
+			}
+			err = g.Wait()
+			close(results)
+		}()
+
+		var sendErr error
+		for res := range results {
+			if sendErr != nil {
+				continue // until the workers have stopped
+			}
+			if sendErr = send(ctx, out, res); sendErr != nil {
+				g.cancel(sendErr)
+			}
+		}
+		if err == nil {
+			err = sendErr
+		}
+		return err
+	}
+}
+
+// OrderedMap is ParallelMap sending the results in the order of the values:
+// up to window values (workers if window < 1) are taken ahead of the oldest
+// one not sent yet, and their results wait for it in that window.
+func OrderedMap[In, Out any](workers, window int, f func(context.Context, In) (Out, error)) Stage[In, Out] {
+	if window < 1 {
+		window = max(workers, 1)
+	}
+	type task struct {
+		val In
+		res chan Out
+	}
+	return func(ctx context.Context, in chan In, out chan Out) error {
+		g, workCtx := newErrGroup(ctx)
+		// the result of every value taken, in order; the one sent next is
+		// out of it already
+		pending := make(chan chan Out, window-1)
+		tasks := make(chan task)
+		do := func(t task) error {
+			res, err := f(workCtx, t.val)
+			if err != nil {
+				return err
+			}
+			t.res <- res // buffered
+			return nil
+		}
+
+		g.Go(func() error {
+			defer close(pending)
+			defer close(tasks)
+			for {
+				val, ok := receive(workCtx, in)
+				if !ok {
+					return nil
+				}
+				t := task{val: val, res: make(chan Out, 1)}
+				if err := send(workCtx, pending, t.res); err != nil {
+					return nil
+				}
+				if workers < 1 {
+					g.Go(func() error { return do(t) })
+				} else if err := send(workCtx, tasks, t); err != nil {
+					return nil
+				}
+			}
+		})
+		for i := 0; i < workers; i++ {
+			g.Go(func() error {
+				for t := range tasks {
+					if err := do(t); err != nil {
+						return err
+					}
+				}
+				return nil
+			})
+		}
+
+		for res := range pending {
+			select {
+			case val := <-res:
+				if err := send(workCtx, out, val); err != nil {
+					g.fail(err)
+				}
+			case <-workCtx.Done(): // failed: the rest is dropped
+			}
+		}
+		return g.Wait()
+	}
+}
+
+func run[In, Out any](ctx context.Context, stage Stage[In, Out], each func(Out)) error {
+	in := make(chan In)
+	close(in) // nothing comes before the first stage
+	out := make(chan Out)
+	done := make(chan error, 1)
+	go func() {
+		done <- runStage(ctx, stage, in, out)
+		close(out)
+	}()
+
+	for val := range out { // after the last stage
+		each(val)
+	}
+	if err := <-done; err != nil {
+		return err
+	}
+	if ctx.Err() != nil {
+		return context.Cause(ctx)
+	}
+	return nil
+}
+
+// Erase turns a typed stage into one on interface{} values, for the job based
+// pipelines; a value of another type than In is an error
+func Erase[In, Out any](stage Stage[In, Out]) Stage[any, any] {
+	unbox := func(ctx context.Context, in chan any, out chan In) error {
+		for {
+			val, ok := receive(ctx, in)
+			if !ok {
+				return nil
+			}
+			typed, ok := val.(In)
+			if !ok {
+				var want In
+				return fmt.Errorf("got %T, want %T", val, want)
+			}
+			if err := send(ctx, out, typed); err != nil {
+				return err
+			}
+		}
+	}
+	box := func(ctx context.Context, in chan Out, out chan any) error {
+		for {
+			val, ok := receive(ctx, in)
+			if !ok {
+				return nil
+			}
+			if err := send(ctx, out, any(val)); err != nil {
+				return err
+			}
+		}
+	}
+	return Then(Then(unbox, stage), box)
+}
+
+func runStage[In, Out any](ctx context.Context, stage Stage[In, Out], in chan In, out chan Out) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return stage(ctx, in, out)
+}
+
+// the next value; false once in is closed or ctx is done
+func receive[T any](ctx context.Context, in chan T) (T, bool) {
+	select {
+	case val, ok := <-in:
+		return val, ok
+	case <-ctx.Done():
+		var zero T
+		return zero, false
+	}
+}
+
+// hand val on unless ctx is done first
+func send[T any](ctx context.Context, out chan T, val T) error {
+	select {
+	case out <- val:
+		return nil
+	case <-ctx.Done():
+		return context.Cause(ctx)
+	}
+}
+
+// goroutines of one job: the first error is kept and cancels the others
+type errGroup struct {
+	wg     sync.WaitGroup
+	once   sync.Once
+	err    error
+	cancel context.CancelCauseFunc
+}
+
+func newErrGroup(ctx context.Context) (*errGroup, context.Context) {
+	ctx, cancel := context.WithCancelCause(ctx)
+	return &errGroup{cancel: cancel}, ctx
+}
+
+func (g *errGroup) fail(err error) {
+	g.once.Do(func() {
+		g.err = err
+		g.cancel(err)
+	})
+}
+
+// Go runs f on a goroutine of the group; a panic of f is its error, as in
+// runStage
+func (g *errGroup) Go(f func() error) {
+	g.wg.Add(1) // +1
+	go func() {
+		defer g.wg.Done() // -1
+		defer func() {
+			if r := recover(); r != nil {
+				g.fail(fmt.Errorf("panic: %v", r))
+			}
+		}()
+		if err := f(); err != nil {
+			g.fail(err)
+		}
+	}()
+}
+
+func (g *errGroup) Wait() error {
+	g.wg.Wait()
+	g.cancel(nil)
+	return g.err
+}
@@ -0,0 +1,243 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestTypedPipeline(t *testing.T) {
+	double := func(ctx context.Context, in chan int, out chan int) error {
+		for num := range in {
+			if err := send(ctx, out, num*2); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	format := func(ctx context.Context, in chan int, out chan string) error {
+		for num := range in {
+			if err := send(ctx, out, "#"+strconv.Itoa(num)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	result, err := Collect(context.Background(), Then(Then(Values(1, 2, 3), double), format))
+	expected := []string{"#2", "#4", "#6"}
+	if err != nil || !reflect.DeepEqual(result, expected) {
+		t.Errorf("results not match\nGot: %v %v\nExpected: %v", err, result, expected)
+	}
+}
+
+func TestTypedPipelineError(t *testing.T) {
+	before := runtime.NumGoroutine()
+	errOdd := errors.New("odd")
+	evenOnly := func(ctx context.Context, in chan int, out chan int) error {
+		for num := range in {
+			if num%2 != 0 {
+				return errOdd
+			}
+			if err := send(ctx, out, num); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	endless := func(ctx context.Context, _ chan struct{}, out chan int) error {
+		for i := 0; ; i += 2 {
+			if i == 10 {
+				i = 11
+			}
+			if err := send(ctx, out, i); err != nil {
+				return err
+			}
+		}
+	}
+
+	_, err := Collect(context.Background(), Then(endless, evenOnly))
+	if !errors.Is(err, errOdd) {
+		t.Errorf("results not match\nGot: %v\nExpected: %v", err, errOdd)
+	}
+	checkGoroutines(t, before)
+}
+
+func TestSignerTyped(t *testing.T) {
+	pipeline := Then(Then(Then(Values(0, 1), SingleHashStage), MultiHashStage), CombineResultsStage)
+	result, err := Collect(context.Background(), pipeline)
+	expected := []string{"29568666068035183841425683795340791879727309630931025356555_4958044192186797981418233587017209679042592862002427381542"}
+	if err != nil || !reflect.DeepEqual(result, expected) {
+		t.Errorf("results not match\nGot: %v %v\nExpected: %v", err, result, expected)
+	}
+}
+
+// the untyped jobs meet the typed stages through Erase
+func TestEraseTypes(t *testing.T) {
+	var result []interface{}
+	err := ExecutePipelineContext(context.Background(),
+		Erase(Values("a", "b")),
+		Erase(func(ctx context.Context, in chan string, out chan string) error {
+			for val := range in {
+				if err := send(ctx, out, strings.ToUpper(val)); err != nil {
+					return err
+				}
+			}
+			return nil
+		}),
+		func(ctx context.Context, in, out chan interface{}) error {
+			for val := range in {
+				result = append(result, val)
+			}
+			return nil
+		},
+	)
+	expected := []interface{}{"A", "B"}
+	if err != nil || !reflect.DeepEqual(result, expected) {
+		t.Errorf("results not match\nGot: %v %v\nExpected: %v", err, result, expected)
+	}
+
+	err = ExecutePipelineContext(context.Background(),
+		Erase(Values(1)),
+		Erase(MultiHashStage),
+	)
+	if err == nil || err.Error() != "job 1: got int, want string" {
+		t.Errorf("results not match\nGot: %v\nExpected: job 1: got int, want string", err)
+	}
+}
+
+func TestParallelMapBounded(t *testing.T) {
+	const workers, buffer = 3, 2
+	var running, peak, sent int32
+	square := ParallelMap(workers, buffer, func(_ context.Context, num int) (int, error) {
+		now := atomic.AddInt32(&running, 1)
+		for {
+			old := atomic.LoadInt32(&peak)
+			if now <= old || atomic.CompareAndSwapInt32(&peak, old, now) {
+				break
+			}
+		}
+		time.Sleep(time.Millisecond)
+		atomic.AddInt32(&running, -1)
+		return num * num, nil
+	})
+	source := func(ctx context.Context, _ chan struct{}, out chan int) error {
+		for i := 0; i < 100; i++ {
+			if err := send(ctx, out, i); err != nil {
+				return err
+			}
+			atomic.AddInt32(&sent, 1)
+		}
+		return nil
+	}
+	slowSink := func(ctx context.Context, in chan int, out chan int) error {
+		time.Sleep(50 * time.Millisecond) // the rest of the pipeline fills up
+		// a value with every worker, one more in the buffer each, the one
+		// the stage is handing on
+		if held := atomic.LoadInt32(&sent); held > workers+buffer+1 {
+			t.Errorf("no backpressure\nGot: %d values taken\nExpected: <=%d", held, workers+buffer+1)
+		}
+		sum := 0
+		for num := range in {
+			sum += num
+		}
+		return send(ctx, out, sum)
+	}
+
+	result, err := Collect(context.Background(), Then(Then(source, square), slowSink))
+	if err != nil || len(result) != 1 || result[0] != 328350 {
+		t.Errorf("results not match\nGot: %v %v\nExpected: [328350]", err, result)
+	}
+	if peak > workers {
+		t.Errorf("too many workers\nGot: %d\nExpected: <=%d", peak, workers)
+	}
+}
+
+func TestParallelMapPanic(t *testing.T) {
+	before := runtime.NumGoroutine()
+	for _, workers := range []int{2, 0} {
+		boom := ParallelMap(workers, 0, func(_ context.Context, num int) (int, error) {
+			if num == 3 {
+				panic("boom")
+			}
+			return num, nil
+		})
+		_, err := Collect(context.Background(), Then(Values(1, 2, 3, 4), boom))
+		if err == nil || err.Error() != "panic: boom" {
+			t.Errorf("results not match\nGot: %v\nExpected: panic: boom", err)
+		}
+	}
+	checkGoroutines(t, before)
+}
+
+func TestOrderedMap(t *testing.T) {
+	const window = 3
+	var running, peak int32
+	slowFirst := func(_ context.Context, num int) (int, error) {
+		now := atomic.AddInt32(&running, 1)
+		for {
+			old := atomic.LoadInt32(&peak)
+			if now <= old || atomic.CompareAndSwapInt32(&peak, old, now) {
+				break
+			}
+		}
+		time.Sleep(time.Duration(20-num) * time.Millisecond) // later values are done first
+		atomic.AddInt32(&running, -1)
+		return num * 10, nil
+	}
+
+	for _, workers := range []int{8, 0} {
+		peak = 0
+		input := []int{0, 1, 2, 3, 4, 5, 6, 7, 8, 9}
+		result, err := Collect(context.Background(), Then(Values(input...), OrderedMap(workers, window, slowFirst)))
+		expected := []int{0, 10, 20, 30, 40, 50, 60, 70, 80, 90}
+		if err != nil || !reflect.DeepEqual(result, expected) {
+			t.Errorf("results not match\nGot: %v %v\nExpected: %v", err, result, expected)
+		}
+		if peak > window {
+			t.Errorf("window overrun\nGot: %d\nExpected: <=%d", peak, window)
+		}
+	}
+}
+
+func TestOrderedMapError(t *testing.T) {
+	before := runtime.NumGoroutine()
+	errFive := errors.New("five")
+	failFive := func(_ context.Context, num int) (int, error) {
+		if num == 5 {
+			return 0, errFive
+		}
+		time.Sleep(time.Millisecond)
+		return num, nil
+	}
+	input := make([]int, 100)
+	for i := range input {
+		input[i] = i
+	}
+
+	result, err := Collect(context.Background(), Then(Values(input...), OrderedMap(4, 8, failFive)))
+	if !errors.Is(err, errFive) || len(result) > 5 {
+		t.Errorf("results not match\nGot: %v %v\nExpected: %v and at most [0 1 2 3 4]", err, result, errFive)
+	}
+
+	// a panic fails the stage the same way, with workers or without
+	panicFive := func(ctx context.Context, num int) (int, error) {
+		if num == 5 {
+			panic("five")
+		}
+		return failFive(ctx, num)
+	}
+	for _, workers := range []int{4, 0} {
+		result, err = Collect(context.Background(), Then(Values(input...), OrderedMap(workers, 8, panicFive)))
+		if err == nil || err.Error() != "panic: five" || len(result) > 5 {
+			t.Errorf("results not match\nGot: %v %v\nExpected: panic: five and at most [0 1 2 3 4]", err, result)
+		}
+	}
+	checkGoroutines(t, before)
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+  "context"
   "fmt"
   "sort"
   "sync"  // (wg) waitgroup
@@ -11,40 +12,23 @@ import (
 // MD5: 10ms (fast), 1-concurrent
 // CRC32: 1s (slow), ∞
 
+// the typed pipeline runs the jobs: one goroutine each, and every channel
+// is closed once the job sending on it returns
 func ExecutePipeline(jobs...job) {
-  // a channel between two jobs
-  var prevChan, currChan chan interface{}
-
-  wg := &sync.WaitGroup{}
-  wg.Add(len(jobs)) // +
-
+  stages := make([]ctxJob, len(jobs))
   for idx, dataJob := range jobs {
-    if idx == 0 { // the first job?
-      prevChan = nil
-      currChan = make(chan interface{})
-    } else if idx == len(jobs)-1 {  // last job?
-      prevChan = currChan
-      currChan = nil  // the end
-    } else {
-      prevChan = currChan
-      currChan = make(chan interface{})
-    }
-
-    // spin jobs
-    go func(job job, in, out chan interface{}) {
-      defer func(ch chan interface{}) {
-        wg.Done() // -1
-        if ch != nil {
-          close(ch)
-        }
-      }(out)
-
-      job(in, out)
-    }(dataJob, prevChan, currChan)
+    stages[idx] = func(dataJob job) ctxJob {
+      return func(_ context.Context, in, out chan interface{}) error {
+        dataJob(in, out)
+        return nil
+      }
+    }(dataJob)
   }
 
-  // exit
-  wg.Wait()
+  // a panicking job is recovered by the pipeline: panic here, as before
+  if err := ExecutePipelineContext(context.Background(), stages...); err != nil {
+    panic(err)
+  }
 }
 
 // ---
@@ -166,8 +150,9 @@ func main() {
       }
     },
 
-    job(SingleHash),
-    job(MultiHash),
+    // a worker per value, as many hashes waiting
+    SingleHashJob(len(arr), len(arr)),
+    MultiHashJob(len(arr), len(arr)),
     job(CombineResults),
     // sink
     func(in, out chan interface{}) {
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// a job that can fail; it should return soon after ctx is done
+type ctxJob = Stage[any, any]
+
+// ExecutePipelineContext runs the jobs like ExecutePipeline. The first error
+// returned (or panicked) by a job, or the end of ctx, cancels the context every
+// job gets; once all jobs have returned, with their channels drained and
+// closed, that error is returned. The first job gets a closed input, what the
+// last one sends is dropped.
+func ExecutePipelineContext(ctx context.Context, jobs ...ctxJob) error {
+	if len(jobs) == 0 {
+		return context.Cause(ctx)
+	}
+	pipeline := numbered(0, jobs[0])
+	for idx, job := range jobs[1:] {
+		pipeline = Then(pipeline, numbered(idx+1, job))
+	}
+	return Run(ctx, pipeline)
+}
+
+// says which job failed
+func numbered(idx int, job ctxJob) ctxJob {
+	return func(ctx context.Context, in, out chan interface{}) error {
+		err := runStage(ctx, job, in, out)
+		if err == nil || ctx.Err() != nil && err == context.Cause(ctx) {
+			return err // nothing, or what stopped every job
+		}
+		return fmt.Errorf("job %d: %w", idx, err)
+	}
+}
+
+// a DataSigner call that panics fails the job instead of the process
+func sign(signer func(string) string, data string) (hash string, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("signing %q: %v", data, r)
+		}
+	}()
+	return signer(data), nil
+}
+
+// ---
+
+func singleHashSigned(data string) (string, error) {
+	var arr [3]string
+	var errs [2]error
+	arr[1] = "~" // the middle element
+
+	wg := &sync.WaitGroup{}
+	wg.Add(2) // 2 go-routines
+	go func() {
+		defer wg.Done() // -1
+		arr[0], errs[0] = sign(DataSignerCrc32, data)
+	}()
+	go func() {
+		defer wg.Done() // -1
+		md5, err := sign(DataSignerMd5Proxy, data)
+		if err != nil {
+			errs[1] = err
+			return
+		}
+		arr[2], errs[1] = sign(DataSignerCrc32, md5)
+	}()
+	wg.Wait()
+
+	if err := errors.Join(errs[:]...); err != nil {
+		return "", err
+	}
+	return strings.Join(arr[:], ""), nil
+}
+
+func singleHashMap(_ context.Context, num int) (string, error) {
+	return singleHashSigned(strconv.Itoa(num))
+}
+
+// SingleHashPool is SingleHash as a typed stage hashing on up to workers
+// goroutines (two signer calls at a time each), with up to buffer hashes
+// waiting for the next stage; see ParallelMap
+func SingleHashPool(workers, buffer int) Stage[int, string] {
+	return ParallelMap(workers, buffer, singleHashMap)
+}
+
+// SingleHashOrdered is SingleHashPool sending the hashes in the order of the
+// values; see OrderedMap
+func SingleHashOrdered(workers, window int) Stage[int, string] {
+	return OrderedMap(workers, window, singleHashMap)
+}
+
+// SingleHashStage is SingleHash as a typed stage, a goroutine per value; a
+// failing signer is an error
+func SingleHashStage(ctx context.Context, in chan int, out chan string) error {
+	return SingleHashPool(0, 0)(ctx, in, out)
+}
+
+// SingleHashContext is SingleHash for ExecutePipelineContext: anything but
+// an int or a failing signer is an error
+func SingleHashContext(ctx context.Context, in, out chan interface{}) error {
+	return Erase(SingleHashStage)(ctx, in, out)
+}
+
+// SingleHashJob is SingleHashPool for ExecutePipeline; a failing signer or a
+// value that is not an int panics there
+func SingleHashJob(workers, buffer int) job {
+	return stageJob(Erase(SingleHashPool(workers, buffer)))
+}
+
+func multiHashSigned(data string) (string, error) {
+	var arr [6]string
+	var errs [6]error
+
+	wg := &sync.WaitGroup{}
+	wg.Add(6) // 6 goroutines in total
+	for th := 0; th <= 5; th++ {
+		go func(i int) {
+			defer wg.Done() // -1
+			arr[i], errs[i] = sign(DataSignerCrc32, strconv.Itoa(i)+data)
+		}(th)
+	}
+	wg.Wait()
+
+	if err := errors.Join(errs[:]...); err != nil {
+		return "", err
+	}
+	return strings.Join(arr[:], ""), nil
+}
+
+func multiHashMap(_ context.Context, data string) (string, error) {
+	return multiHashSigned(data)
+}
+
+// MultiHashPool is MultiHash as a typed stage hashing on up to workers
+// goroutines (six signer calls at a time each), with up to buffer hashes
+// waiting for the next stage; see ParallelMap
+func MultiHashPool(workers, buffer int) Stage[string, string] {
+	return ParallelMap(workers, buffer, multiHashMap)
+}
+
+// MultiHashOrdered is MultiHashPool sending the hashes in the order of the
+// values; see OrderedMap
+func MultiHashOrdered(workers, window int) Stage[string, string] {
+	return OrderedMap(workers, window, multiHashMap)
+}
+
+// MultiHashStage is MultiHash as a typed stage, a goroutine per value
+func MultiHashStage(ctx context.Context, in chan string, out chan string) error {
+	return MultiHashPool(0, 0)(ctx, in, out)
+}
+
+// MultiHashContext is MultiHash for ExecutePipelineContext
+func MultiHashContext(ctx context.Context, in, out chan interface{}) error {
+	return Erase(MultiHashStage)(ctx, in, out)
+}
+
+// MultiHashJob is MultiHashPool for ExecutePipeline
+func MultiHashJob(workers, buffer int) job {
+	return stageJob(Erase(MultiHashPool(workers, buffer)))
+}
+
+// a job running stage until its input is closed; an error is a panic, which
+// ExecutePipeline hands on
+func stageJob(stage ctxJob) job {
+	return func(in, out chan interface{}) {
+		if err := stage(context.Background(), in, out); err != nil {
+			panic(err)
+		}
+	}
+}
+
+// CombineResultsStage is CombineResults as a typed stage
+func CombineResultsStage(ctx context.Context, in chan string, out chan string) error {
+	var arr []string
+	for {
+		hash, ok := receive(ctx, in)
+		if !ok {
+			break
+		}
+		arr = append(arr, hash)
+	}
+	if ctx.Err() != nil {
+		return nil // cut short: the pipeline reports why
+	}
+	sort.Strings(arr)
+	return send(ctx, out, strings.Join(arr, "_"))
+}
+
+// CombineResultsContext is CombineResults for ExecutePipelineContext
+func CombineResultsContext(ctx context.Context, in, out chan interface{}) error {
+	return Erase(CombineResultsStage)(ctx, in, out)
+}
@@ -0,0 +1,251 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// the goroutines running when the test started, and none more, once the
+// pipeline has returned
+func checkGoroutines(t *testing.T, before int) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for runtime.NumGoroutine() > before && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if now := runtime.NumGoroutine(); now > before {
+		t.Errorf("goroutines leaked\nGot: %d\nExpected: %d", now, before)
+	}
+}
+
+// sends until ctx is done
+func endless(ctx context.Context, in, out chan interface{}) error {
+	for i := 0; ; i++ {
+		if err := send[interface{}](ctx, out, i); err != nil {
+			return err
+		}
+	}
+}
+
+func TestPipelineContextError(t *testing.T) {
+	before := runtime.NumGoroutine()
+	errFail := errors.New("third value")
+	var sinkDone uint32
+
+	err := ExecutePipelineContext(context.Background(),
+		endless,
+		func(ctx context.Context, in, out chan interface{}) error {
+			for val := range in {
+				if val.(int) == 3 {
+					return errFail
+				}
+				if err := send(ctx, out, val); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+		// ignores ctx: the closed input ends it
+		func(ctx context.Context, in, out chan interface{}) error {
+			for range in {
+			}
+			atomic.StoreUint32(&sinkDone, 1)
+			return nil
+		},
+	)
+
+	if !errors.Is(err, errFail) {
+		t.Errorf("results not match\nGot: %v\nExpected: %v", err, errFail)
+	}
+	if atomic.LoadUint32(&sinkDone) != 1 {
+		t.Errorf("the last job did not see its input closed")
+	}
+	checkGoroutines(t, before)
+}
+
+func TestPipelineContextCancel(t *testing.T) {
+	before := runtime.NumGoroutine()
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	err := ExecutePipelineContext(ctx,
+		endless,
+		// stops reading on its own; the pipeline drains what is left
+		func(ctx context.Context, in, out chan interface{}) error {
+			<-in
+			return nil
+		},
+		func(ctx context.Context, in, out chan interface{}) error {
+			<-ctx.Done()
+			return ctx.Err()
+		},
+	)
+	end := time.Since(start)
+
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("results not match\nGot: %v\nExpected: %v", err, context.DeadlineExceeded)
+	}
+	if end > time.Second {
+		t.Errorf("execition too long\nGot: %s\nExpected: <%s", end, time.Second)
+	}
+	checkGoroutines(t, before)
+}
+
+func TestPipelineContextPanic(t *testing.T) {
+	err := ExecutePipelineContext(context.Background(),
+		func(ctx context.Context, in, out chan interface{}) error {
+			var m map[string]int
+			m["boom"]++
+			return nil
+		},
+	)
+	if err == nil || !strings.Contains(err.Error(), "job 0: panic:") {
+		t.Errorf("results not match\nGot: %v\nExpected: job 0: panic: ...", err)
+	}
+}
+
+func TestSignerContext(t *testing.T) {
+	var result interface{}
+	err := ExecutePipelineContext(context.Background(),
+		func(ctx context.Context, in, out chan interface{}) error {
+			for _, num := range []int{0, 1} {
+				if err := send[interface{}](ctx, out, num); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+		SingleHashContext,
+		MultiHashContext,
+		CombineResultsContext,
+		func(ctx context.Context, in, out chan interface{}) error {
+			result = <-in
+			return nil
+		},
+	)
+	expected := "29568666068035183841425683795340791879727309630931025356555_4958044192186797981418233587017209679042592862002427381542"
+	if err != nil || result != expected {
+		t.Errorf("results not match\nGot: %v %v\nExpected: %v", err, result, expected)
+	}
+}
+
+// the bounded hashing stages in a plain ExecutePipeline
+func TestSignerJob(t *testing.T) {
+	var result interface{}
+	start := time.Now()
+	ExecutePipeline(
+		numbers(0, 1, 1, 2),
+		SingleHashJob(2, 1),
+		MultiHashJob(2, 1),
+		job(CombineResults),
+		func(in, out chan interface{}) {
+			result = <-in
+		},
+	)
+	end := time.Since(start)
+
+	expected := "27225454331033649287118297354036464389062965355426795162684_29568666068035183841425683795340791879727309630931025356555_4958044192186797981418233587017209679042592862002427381542_4958044192186797981418233587017209679042592862002427381542"
+	if result != expected {
+		t.Errorf("results not match\nGot: %v\nExpected: %v", result, expected)
+	}
+	// two values at a time in both stages
+	if expectedTime := 4500 * time.Millisecond; end > expectedTime {
+		t.Errorf("execition too long\nGot: %s\nExpected: <%s", end, expectedTime)
+	}
+}
+
+func TestSignerContextFailure(t *testing.T) {
+	crc32 := DataSignerCrc32
+	defer func() { DataSignerCrc32 = crc32 }()
+	DataSignerCrc32 = func(data string) string {
+		if data == "1" {
+			panic("crc32 is down")
+		}
+		return crc32(data)
+	}
+
+	before := runtime.NumGoroutine()
+	err := ExecutePipelineContext(context.Background(),
+		func(ctx context.Context, in, out chan interface{}) error {
+			for _, num := range []int{0, 1, 2} {
+				if err := send[interface{}](ctx, out, num); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+		SingleHashContext,
+		MultiHashContext,
+		CombineResultsContext,
+	)
+	if err == nil || !strings.Contains(err.Error(), "crc32 is down") {
+		t.Errorf("results not match\nGot: %v\nExpected: ... crc32 is down", err)
+	}
+	checkGoroutines(t, before)
+
+	err = ExecutePipelineContext(context.Background(),
+		func(ctx context.Context, in, out chan interface{}) error {
+			return send(ctx, out, "0")
+		},
+		SingleHashContext,
+	)
+	if err == nil || !strings.Contains(err.Error(), "got string, want int") {
+		t.Errorf("results not match\nGot: %v\nExpected: ... got string, want int", err)
+	}
+}
+
+// hashes per second of SingleHash -> MultiHash by pool size, with signers
+// taking a millisecond: go test -bench SignerPool
+func BenchmarkSignerPool(b *testing.B) {
+	crc32, md5 := DataSignerCrc32, DataSignerMd5
+	defer func() { DataSignerCrc32, DataSignerMd5 = crc32, md5 }()
+	DataSignerCrc32 = func(data string) string {
+		time.Sleep(time.Millisecond)
+		return data
+	}
+	DataSignerMd5 = func(data string) string {
+		return data // one at a time anyway, see DataSignerMd5Proxy
+	}
+
+	const items = 256
+	input := make([]int, items)
+	for i := range input {
+		input[i] = i
+	}
+	for _, workers := range []int{1, 4, 16, 64, 0} {
+		name := "workers=" + strconv.Itoa(workers)
+		if workers == 0 {
+			name = "unbounded"
+		}
+		b.Run(name, func(b *testing.B) {
+			pipeline := Then(Then(Values(input...), SingleHashPool(workers, workers)), MultiHashPool(workers, workers))
+			for i := 0; i < b.N; i++ {
+				if err := Run(context.Background(), pipeline); err != nil {
+					b.Fatal(err)
+				}
+			}
+			b.ReportMetric(float64(items*b.N)/b.Elapsed().Seconds(), "hashes/s")
+		})
+	}
+}
+
+// without CombineResults' sort, the hashes in the order of the values
+func TestSignerOrdered(t *testing.T) {
+	pipeline := Then(Then(Values(1, 0), SingleHashOrdered(2, 2)), MultiHashOrdered(2, 2))
+	result, err := Collect(context.Background(), pipeline)
+	expected := []string{
+		"4958044192186797981418233587017209679042592862002427381542",
+		"29568666068035183841425683795340791879727309630931025356555",
+	}
+	if err != nil || !reflect.DeepEqual(result, expected) {
+		t.Errorf("results not match\nGot: %v %v\nExpected: %v", err, result, expected)
+	}
+}